@@ -0,0 +1,653 @@
+// Audio file metadata. Only the bare minimum required for queue management is
+// parsed (i.e. duration and basic tags), and only for the handful of formats
+// that are realistically found in a music library. No external tools (e.g.
+// ffprobe) are required.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Duration/tags can only be read for some of these
+var audioExts = map[string]any{
+	".aac":  nil,
+	".ape":  nil,
+	".flac": nil,
+	".m4a":  nil,
+	".mp3":  nil,
+	".ogg":  nil,
+	".opus": nil,
+	".wav":  nil,
+	".wv":   nil,
+}
+
+var errUnknownFormat = errors.New("unknown audio format")
+
+func isAudio(name string) bool {
+	_, ok := audioExts[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// Returns fullpaths of all audio files under an album directory, in lexical
+// order. Subdirectories (e.g. CD1, CD2) are descended into, so multi-disc
+// albums are returned as a single ordered list.
+func albumTracks(fullpath string) ([]string, error) {
+	var tracks []string
+	err := filepath.WalkDir(fullpath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && isAudio(d.Name()) {
+			tracks = append(tracks, path)
+		}
+		return nil
+	})
+	return tracks, err
+}
+
+// Total duration of all audio files in an album (relative to root). Files
+// whose duration cannot be determined are skipped; if no file could be
+// parsed, an error is returned.
+func albumDuration(relpath string) (time.Duration, error) {
+	tracks, err := albumTracks(filepath.Join(config.Library.Root, relpath))
+	if err != nil {
+		return 0, err
+	}
+	var total time.Duration
+	var ok bool
+	for _, t := range tracks {
+		d, err := trackDuration(t)
+		if err != nil {
+			continue
+		}
+		total += d
+		ok = true
+	}
+	if !ok {
+		return 0, errUnknownFormat
+	}
+	return total, nil
+}
+
+func trackDuration(path string) (time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		return flacDuration(f)
+	case ".mp3":
+		return mp3Duration(f)
+	case ".ogg", ".opus":
+		return oggDuration(f)
+	case ".m4a":
+		return mp4Duration(f)
+	default:
+		return 0, errUnknownFormat
+	}
+}
+
+func seconds(n uint64, rate uint64) time.Duration {
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(float64(n) / float64(rate) * float64(time.Second))
+}
+
+// Returns the number of bytes occupied by an ID3v2 tag at the start of r (0
+// if there is none). r is rewound.
+func id3v2Size(r io.ReadSeeker) (int64, error) {
+	h := make([]byte, 10)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if string(h[:3]) != "ID3" {
+		return 0, nil
+	}
+	// syncsafe int: 7 bits per byte
+	size := int64(h[6])<<21 | int64(h[7])<<14 | int64(h[8])<<7 | int64(h[9])
+	size += 10
+	if h[5]&0x10 != 0 { // footer
+		size += 10
+	}
+	return size, nil
+}
+
+// https://xiph.org/flac/format.html#metadata_block_streaminfo
+func flacDuration(r io.ReadSeeker) (time.Duration, error) {
+	skip, err := id3v2Size(r)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(skip, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// "fLaC" + block header (4) + STREAMINFO (34)
+	b := make([]byte, 42)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
+	}
+	if string(b[:4]) != "fLaC" || b[4]&0x7f != 0 {
+		return 0, errUnknownFormat
+	}
+	si := b[8:]
+	rate := uint64(si[10])<<12 | uint64(si[11])<<4 | uint64(si[12])>>4
+	samples := uint64(si[13]&0x0f)<<32 | uint64(binary.BigEndian.Uint32(si[14:18]))
+	return seconds(samples, rate), nil
+}
+
+var (
+	mp3Bitrates = map[bool][16]uint64{
+		// MPEG-1 Layer III
+		true: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		// MPEG-2/2.5 Layer III
+		false: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	}
+	mp3Rates = [3]uint64{44100, 48000, 32000}
+)
+
+// Only Layer III is supported. VBR files are expected to have a Xing/Info or
+// VBRI header (which any sane encoder writes); otherwise CBR is assumed and the
+// duration is estimated from the file size.
+//
+// http://www.mp3-tech.org/programmer/frame_header.html
+func mp3Duration(r io.ReadSeeker) (time.Duration, error) {
+	start, err := id3v2Size(r)
+	if err != nil {
+		return 0, err
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// some taggers pad generously, so the first frame is not necessarily
+	// at start
+	buf := make([]byte, 64*1024)
+	n, _ := io.ReadFull(r, buf)
+	buf = buf[:n]
+
+	var i int
+	for ; i+4 <= len(buf); i++ {
+		if buf[i] == 0xff && buf[i+1]&0xe0 == 0xe0 &&
+			(buf[i+1]>>3)&3 != 1 && // reserved version
+			(buf[i+1]>>1)&3 == 1 && // layer III
+			buf[i+2]>>4 != 0x0f && (buf[i+2]>>2)&3 != 3 {
+			break
+		}
+	}
+	if i+4 > len(buf) {
+		return 0, errUnknownFormat
+	}
+	h := buf[i:]
+
+	version := (h[1] >> 3) & 3 // 3 = MPEG-1, 2 = MPEG-2, 0 = MPEG-2.5
+	mpeg1 := version == 3
+	rate := mp3Rates[(h[2]>>2)&3]
+	spf := uint64(1152)
+	switch version {
+	case 2:
+		rate /= 2
+		spf = 576
+	case 0:
+		rate /= 4
+		spf = 576
+	}
+	mono := h[3]>>6 == 3
+
+	// side info length determines where the Xing header is
+	var xing int
+	switch {
+	case mpeg1 && mono:
+		xing = 4 + 17
+	case mpeg1:
+		xing = 4 + 32
+	case mono:
+		xing = 4 + 9
+	default:
+		xing = 4 + 17
+	}
+
+	if len(h) >= xing+12 {
+		tag := string(h[xing : xing+4])
+		if (tag == "Xing" || tag == "Info") && h[xing+7]&1 != 0 {
+			frames := binary.BigEndian.Uint32(h[xing+8 : xing+12])
+			return seconds(uint64(frames)*spf, rate), nil
+		}
+	}
+	if len(h) >= 4+32+18 && string(h[36:40]) == "VBRI" {
+		frames := binary.BigEndian.Uint32(h[36+14 : 36+18])
+		return seconds(uint64(frames)*spf, rate), nil
+	}
+
+	kbps := mp3Bitrates[mpeg1][h[2]>>4]
+	if kbps == 0 {
+		return 0, errUnknownFormat
+	}
+	audio := uint64(end - start - int64(i))
+	return seconds(audio*8, kbps*1000), nil
+}
+
+// Vorbis and Opus only. The duration is the granule position of the last page,
+// which is why the end of the file is read first.
+//
+// https://xiph.org/ogg/doc/framing.html
+func oggDuration(r io.ReadSeeker) (time.Duration, error) {
+	first := make([]byte, 27+255+19)
+	n, _ := io.ReadFull(r, first)
+	first = first[:n]
+	if n < 27 || string(first[:4]) != "OggS" || 27+int(first[26]) >= n {
+		return 0, errUnknownFormat
+	}
+	payload := first[27+int(first[26]):]
+
+	var rate, preskip uint64
+	switch {
+	case bytes.HasPrefix(payload, []byte("\x01vorbis")) && len(payload) >= 16:
+		rate = uint64(binary.LittleEndian.Uint32(payload[12:16]))
+	case bytes.HasPrefix(payload, []byte("OpusHead")) && len(payload) >= 12:
+		// granule position is always in 48 kHz, regardless of input
+		// sample rate
+		rate = 48000
+		preskip = uint64(binary.LittleEndian.Uint16(payload[10:12]))
+	default:
+		return 0, errUnknownFormat
+	}
+
+	// max page size is ~64 KiB
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	from := max(0, end-65307)
+	if _, err := r.Seek(from, io.SeekStart); err != nil {
+		return 0, err
+	}
+	tail, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	i := bytes.LastIndex(tail, []byte("OggS"))
+	if i < 0 || i+14 > len(tail) {
+		return 0, errUnknownFormat
+	}
+	granule := binary.LittleEndian.Uint64(tail[i+6 : i+14])
+	if granule < preskip {
+		return 0, errUnknownFormat
+	}
+	return seconds(granule-preskip, rate), nil
+}
+
+// Reads timescale and duration from moov/mvhd.
+//
+// https://developer.apple.com/documentation/quicktime-file-format/movie_header_atom
+func mp4Duration(r io.ReadSeeker) (time.Duration, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	var find func(from int64, to int64, path ...string) (int64, error)
+	find = func(from int64, to int64, path ...string) (int64, error) {
+		h := make([]byte, 16)
+		for pos := from; pos+8 <= to; {
+			if _, err := r.Seek(pos, io.SeekStart); err != nil {
+				return 0, err
+			}
+			if _, err := io.ReadFull(r, h[:8]); err != nil {
+				return 0, err
+			}
+			size := int64(binary.BigEndian.Uint32(h[:4]))
+			hdr := int64(8)
+			switch size {
+			case 0: // extends to end of file
+				size = to - pos
+			case 1: // 64-bit size
+				if _, err := io.ReadFull(r, h[8:16]); err != nil {
+					return 0, err
+				}
+				size = int64(binary.BigEndian.Uint64(h[8:16]))
+				hdr = 16
+			}
+			if size < hdr {
+				return 0, errUnknownFormat
+			}
+			if string(h[4:8]) == path[0] {
+				if len(path) == 1 {
+					return pos + hdr, nil
+				}
+				return find(pos+hdr, pos+size, path[1:]...)
+			}
+			pos += size
+		}
+		return 0, errUnknownFormat
+	}
+
+	pos, err := find(0, end, "moov", "mvhd")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		return 0, err
+	}
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
+	}
+	switch b[0] { // version
+	case 0:
+		scale := binary.BigEndian.Uint32(b[12:16])
+		dur := binary.BigEndian.Uint32(b[16:20])
+		return seconds(uint64(dur), uint64(scale)), nil
+	case 1:
+		scale := binary.BigEndian.Uint32(b[20:24])
+		dur := binary.BigEndian.Uint64(b[24:32])
+		return seconds(dur, uint64(scale)), nil
+	default:
+		return 0, errUnknownFormat
+	}
+}
+
+// Format duration as m:ss, or h:mm:ss if longer than an hour
+func fmtDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+// tags {{{
+
+type trackTags struct {
+	Artist string
+	Album  string
+	Title  string
+	Track  int
+	Mbid   string // musicbrainz recording id
+}
+
+// Read tags of a track. Missing fields are filled in from the path, assuming
+// the usual artist/album/track layout (relative to root); this means that a
+// usable (if crude) result is always returned.
+func readTags(path string) trackTags {
+	var t trackTags
+	if f, err := os.Open(path); err == nil {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".flac":
+			t, _ = flacTags(f)
+		case ".mp3":
+			t, _ = id3v2Tags(f)
+		case ".ogg", ".opus":
+			t, _ = oggTags(f)
+		}
+		f.Close()
+	}
+
+	if t.Title == "" {
+		t.Title = trackTitle(filepath.Base(path))
+	}
+	rel, err := filepath.Rel(config.Library.Root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return t
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if t.Artist == "" && len(parts) > 0 {
+		t.Artist = parts[0]
+	}
+	if t.Album == "" && len(parts) > 1 {
+		t.Album = strings.TrimSpace(yearSuffix.ReplaceAllString(parts[1], ""))
+	}
+	return t
+}
+
+var (
+	yearSuffix  = regexp.MustCompile(` \(\d{4}\)$`)
+	trackPrefix = regexp.MustCompile(`^\d+[\s.\-_]*`)
+)
+
+// "01 - Foo.flac" -> "Foo"
+func trackTitle(base string) string {
+	title := strings.TrimSuffix(base, filepath.Ext(base))
+	if t := trackPrefix.ReplaceAllString(title, ""); t != "" {
+		return t
+	}
+	return title
+}
+
+// "3/12" -> 3
+func trackNumber(s string) int {
+	n, _ := strconv.Atoi(strings.Split(strings.TrimSpace(s), "/")[0])
+	return n
+}
+
+// Parse a vorbis comment block (without framing bit)
+//
+// https://www.xiph.org/vorbis/doc/v-comment.html
+func vorbisComments(b []byte) (trackTags, error) {
+	var t trackTags
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := binary.LittleEndian.Uint32(b[:4])
+		if uint64(len(b)-4) < uint64(n) {
+			return nil, false
+		}
+		s := b[4 : 4+n]
+		b = b[4+n:]
+		return s, true
+	}
+
+	if _, ok := next(); !ok { // vendor
+		return t, errUnknownFormat
+	}
+	if len(b) < 4 {
+		return t, errUnknownFormat
+	}
+	count := binary.LittleEndian.Uint32(b[:4])
+	b = b[4:]
+	for range count {
+		c, ok := next()
+		if !ok {
+			return t, errUnknownFormat
+		}
+		k, v, _ := strings.Cut(string(c), "=")
+		switch strings.ToUpper(k) {
+		case "ARTIST":
+			t.Artist = v
+		case "ALBUM":
+			t.Album = v
+		case "TITLE":
+			t.Title = v
+		case "TRACKNUMBER":
+			t.Track = trackNumber(v)
+		case "MUSICBRAINZ_TRACKID":
+			t.Mbid = v
+		}
+	}
+	return t, nil
+}
+
+func flacTags(r io.ReadSeeker) (trackTags, error) {
+	skip, err := id3v2Size(r)
+	if err != nil {
+		return trackTags{}, err
+	}
+	if _, err := r.Seek(skip, io.SeekStart); err != nil {
+		return trackTags{}, err
+	}
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "fLaC" {
+		return trackTags{}, errUnknownFormat
+	}
+
+	h := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, h); err != nil {
+			return trackTags{}, err
+		}
+		last := h[0]&0x80 != 0
+		size := int64(h[1])<<16 | int64(h[2])<<8 | int64(h[3])
+		if h[0]&0x7f == 4 { // VORBIS_COMMENT
+			b := make([]byte, size)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return trackTags{}, err
+			}
+			return vorbisComments(b)
+		}
+		if last {
+			return trackTags{}, nil
+		}
+		if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+			return trackTags{}, err
+		}
+	}
+}
+
+// The comment header is the second packet of the stream. It is assumed to be
+// within the first 64 KiB, which is only not the case if cover art is
+// embedded (in which case the essential fields usually come first anyway).
+func oggTags(r io.Reader) (trackTags, error) {
+	b := make([]byte, 64*1024)
+	n, _ := io.ReadFull(r, b)
+	b = b[:n]
+
+	// concatenate payloads of all pages after the first
+	var payload []byte
+	for page := 0; len(b) >= 27 && string(b[:4]) == "OggS"; page++ {
+		nseg := int(b[26])
+		if len(b) < 27+nseg {
+			break
+		}
+		size := 0
+		for _, l := range b[27 : 27+nseg] {
+			size += int(l)
+		}
+		end := min(len(b), 27+nseg+size)
+		if page > 0 {
+			payload = append(payload, b[27+nseg:end]...)
+		}
+		b = b[end:]
+	}
+
+	switch {
+	case bytes.HasPrefix(payload, []byte("\x03vorbis")):
+		return vorbisComments(payload[7:])
+	case bytes.HasPrefix(payload, []byte("OpusTags")):
+		return vorbisComments(payload[8:])
+	default:
+		return trackTags{}, errUnknownFormat
+	}
+}
+
+// Decode an ID3v2 text frame (first byte is encoding)
+func id3Text(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	enc, b := b[0], b[1:]
+	switch enc {
+	case 1, 2: // UTF-16 (with BOM), UTF-16BE
+		var order binary.ByteOrder = binary.BigEndian
+		if enc == 1 && len(b) >= 2 {
+			if b[0] == 0xff && b[1] == 0xfe {
+				order = binary.LittleEndian
+			}
+			b = b[2:]
+		}
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			u[i] = order.Uint16(b[2*i:])
+		}
+		return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+	case 3: // UTF-8
+		return strings.TrimRight(string(b), "\x00")
+	default: // ISO-8859-1
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return strings.TrimRight(string(r), "\x00")
+	}
+}
+
+// ID3v2.3 and v2.4 only
+//
+// https://id3.org/id3v2.4.0-structure
+func id3v2Tags(r io.ReadSeeker) (trackTags, error) {
+	size, err := id3v2Size(r)
+	if err != nil || size == 0 {
+		return trackTags{}, errUnknownFormat
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return trackTags{}, err
+	}
+	version := b[3]
+	if version != 3 && version != 4 {
+		return trackTags{}, errUnknownFormat
+	}
+
+	var t trackTags
+	b = b[10:]
+	for len(b) >= 10 && b[0] != 0 {
+		id := string(b[:4])
+		var n int
+		if version == 4 { // syncsafe
+			n = int(b[4])<<21 | int(b[5])<<14 | int(b[6])<<7 | int(b[7])
+		} else {
+			n = int(binary.BigEndian.Uint32(b[4:8]))
+		}
+		if n > len(b)-10 {
+			break
+		}
+		data := b[10 : 10+n]
+		b = b[10+n:]
+
+		switch id {
+		case "TPE1":
+			t.Artist = id3Text(data)
+		case "TALB":
+			t.Album = id3Text(data)
+		case "TIT2":
+			t.Title = id3Text(data)
+		case "TRCK":
+			t.Track = trackNumber(id3Text(data))
+		case "UFID":
+			owner, id, ok := bytes.Cut(data, []byte{0})
+			if ok && string(owner) == "http://musicbrainz.org" {
+				t.Mbid = string(id)
+			}
+		}
+	}
+	return t, nil
+}
+
+// }}}
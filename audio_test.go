@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuration(t *testing.T) {
+	// STREAMINFO: 44.1 kHz, 2 ch, 16 bit, 441000 samples
+	si := make([]byte, 34)
+	si[10] = 0x0a // 44100 = 0xac44
+	si[11] = 0xc4
+	si[12] = 0x42
+	si[13] = 0xf0
+	binary.BigEndian.PutUint32(si[14:18], 441000)
+	flac := append([]byte("fLaC\x80\x00\x00\x22"), si...)
+	d, err := flacDuration(bytes.NewReader(flac))
+	assert.Nil(t, err)
+	assert.Equal(t, d, 10*time.Second)
+
+	// MPEG-1 Layer III, 128 kbps, 44.1 kHz, stereo, no Xing header: CBR
+	// estimate from size
+	mp3 := make([]byte, 160000)
+	copy(mp3, []byte{0xff, 0xfb, 0x90, 0x00})
+	d, err = mp3Duration(bytes.NewReader(mp3))
+	assert.Nil(t, err)
+	assert.Equal(t, d, 10*time.Second)
+
+	// same, but with Xing header (1000 frames)
+	copy(mp3[36:], "Xing\x00\x00\x00\x01")
+	binary.BigEndian.PutUint32(mp3[44:48], 1000)
+	d, err = mp3Duration(bytes.NewReader(mp3))
+	assert.Nil(t, err)
+	assert.Equal(t, d.Round(time.Millisecond), 26122*time.Millisecond)
+
+	_, err = flacDuration(bytes.NewReader(mp3))
+	assert.Equal(t, err, errUnknownFormat)
+}
+
+// Minimal FLAC file: STREAMINFO (44.1 kHz) + VORBIS_COMMENT, no audio
+func makeFlac(d time.Duration, comments ...string) []byte {
+	si := make([]byte, 34)
+	si[10], si[11], si[12] = 0x0a, 0xc4, 0x42
+	binary.BigEndian.PutUint32(si[14:18], uint32(d.Seconds()*44100))
+	b := append([]byte("fLaC\x00\x00\x00\x22"), si...)
+
+	vc := binary.LittleEndian.AppendUint32(nil, 0) // empty vendor
+	vc = binary.LittleEndian.AppendUint32(vc, uint32(len(comments)))
+	for _, c := range comments {
+		vc = binary.LittleEndian.AppendUint32(vc, uint32(len(c)))
+		vc = append(vc, c...)
+	}
+	b = append(b, 0x84, byte(len(vc)>>16), byte(len(vc)>>8), byte(len(vc)))
+	return append(b, vc...)
+}
+
+func TestTags(t *testing.T) {
+	tags, err := flacTags(bytes.NewReader(makeFlac(time.Minute, "ARTIST=a", "title=b", "TRACKNUMBER=3/9")))
+	assert.Nil(t, err)
+	assert.Equal(t, tags, trackTags{Artist: "a", Title: "b", Track: 3})
+
+	// ID3v2.3 with TIT2 (UTF-16) and TPE1 (ISO-8859-1)
+	frame := func(id string, data []byte) []byte {
+		return append(binary.BigEndian.AppendUint32([]byte(id), uint32(len(data))), append([]byte{0, 0}, data...)...)
+	}
+	frames := append(
+		frame("TIT2", []byte{1, 0xff, 0xfe, 'x', 0, 'y', 0}),
+		frame("TPE1", []byte{0, 'z', 0xe9})...,
+	)
+	id3 := append([]byte("ID3\x03\x00\x00\x00\x00\x00"), byte(len(frames)))
+	tags, err = id3v2Tags(bytes.NewReader(append(id3, frames...)))
+	assert.Nil(t, err)
+	assert.Equal(t, tags, trackTags{Artist: "zé", Title: "xy"})
+
+	assert.Equal(t, trackTitle("01 - Foo Bar.flac"), "Foo Bar")
+	assert.Equal(t, trackTitle("1999.mp3"), "1999")
+}
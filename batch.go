@@ -0,0 +1,265 @@
+// Library-wide matching against Discogs, e.g. overnight:
+//
+//	plaque discogs match -all -o report.tsv
+//
+// Every album is matched (see discogs.Matches), and the outcome is appended
+// to a results file in the state dir as soon as it is known. An interrupted
+// run thus resumes where it stopped; albums that were matched or not found
+// (or have a mapping) are not matched again. Confident matches are saved to
+// the mapping store; ambiguous ones are left for the user to confirm (e.g.
+// with ctrl+e in the Browser), and are matched again until they are.
+//
+// Requests go through the usual client, and are thus rate limited (and
+// cached). The run stops at the first error that is likely to recur for the
+// next album (network, auth, rate limit), so that it can simply be restarted
+// later.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"plaque/discogs"
+)
+
+// Outcomes of matching an album
+const (
+	matchMatched   = "matched"
+	matchAmbiguous = "ambiguous"
+	matchNotFound  = "not found"
+	matchMapped    = "mapped" // already in the mapping store; not matched
+	matchError     = "error"  // e.g. an unparseable response
+)
+
+// If the top two candidates are both confident, but this close, neither is
+// taken
+const matchMargin = 0.05
+
+type matchResult struct {
+	Relpath string    `json:"relpath"`
+	Status  string    `json:"status"`
+	Score   float64   `json:"score,omitempty"` // of the best candidate
+	URL     string    `json:"url,omitempty"`   // of the best candidate
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Other outcomes are retried by later runs; an ambiguous album may have been
+// mapped since, and errors are often temporary (e.g. 5xx)
+func (r matchResult) done() bool {
+	return r.Status == matchMatched || r.Status == matchNotFound
+}
+
+func matchResultsPath() string { return statePath("discogs_match.jsonl") }
+
+// Results of previous (possibly interrupted) runs, keyed by relpath. Later
+// results replace earlier ones.
+func readMatchResults() map[string]matchResult {
+	results := make(map[string]matchResult)
+	f, err := os.Open(matchResultsPath())
+	if err != nil {
+		return results
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var r matchResult
+		// the last line may be truncated, if the run was killed
+		if json.Unmarshal(sc.Bytes(), &r) != nil {
+			continue
+		}
+		results[r.Relpath] = r
+	}
+	return results
+}
+
+func appendMatchResult(r matchResult) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(matchResultsPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Relpaths of all albums in the library, in lexical order
+func libraryAlbums() ([]string, error) {
+	artists, err := os.ReadDir(config.Library.Root)
+	if err != nil {
+		return nil, err
+	}
+	var albums []string
+	for _, artist := range artists {
+		if !artist.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(config.Library.Root, artist.Name()))
+		if err != nil {
+			log.Println("skipping:", artist.Name(), err)
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				albums = append(albums, filepath.Join(artist.Name(), e.Name()))
+			}
+		}
+	}
+	return albums, nil
+}
+
+// Errors that would most likely also affect the next album
+func fatalMatchError(err error) bool {
+	return errors.Is(err, discogs.ErrNetwork) ||
+		errors.Is(err, discogs.ErrAuth) ||
+		errors.Is(err, discogs.ErrRateLimited)
+}
+
+// Match a single album. Confident matches are saved to the mapping store.
+func matchAlbum(relpath string) (matchResult, error) {
+	res := matchResult{Relpath: relpath, Time: time.Now()}
+
+	matches, err := discogs.Matches((&postPlayback{relpath: relpath}).local())
+	switch {
+	case errors.Is(err, discogs.ErrNotFound):
+		res.Status = matchNotFound
+		return res, nil
+	case fatalMatchError(err):
+		return res, err
+	case err != nil:
+		res.Status = matchError
+		res.Error = err.Error()
+		return res, nil
+	}
+
+	best := matches[0]
+	res.Score = best.Score
+	res.URL = best.Release.URL()
+	tied := len(matches) > 1 && best.Score-matches[1].Score < matchMargin
+	if !best.Confident() || tied {
+		res.Status = matchAmbiguous
+		return res, nil
+	}
+
+	res.Status = matchMatched
+	return res, mapAlbum(relpath, releaseMapping(best.Release))
+}
+
+func writeMatchReport(w io.Writer, format string, results []matchResult) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "tsv":
+		if _, err := fmt.Fprintln(w, "relpath\tstatus\tscore\turl"); err != nil {
+			return err
+		}
+		for _, r := range results {
+			score := ""
+			if r.Score > 0 {
+				score = strconv.FormatFloat(r.Score, 'f', 2, 64)
+			}
+			if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Relpath, r.Status, score, r.URL); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid format: %s", format)
+	}
+}
+
+// Match all albums without a result, and report on all albums. If matching
+// stops early, the report is not written, and the error is returned.
+func matchLibrary(w io.Writer, format string, progress io.Writer) error {
+	albums, err := libraryAlbums()
+	if err != nil {
+		return err
+	}
+	results := readMatchResults()
+	mapped := readMapping().Albums
+
+	counts := make(map[string]int)
+	var report []matchResult
+	for i, relpath := range albums {
+		res, ok := results[relpath]
+		switch {
+		case ok && res.done():
+		case mapped[relpath].Id > 0:
+			res = matchResult{Relpath: relpath, Status: matchMapped, URL: mapped[relpath].String()}
+		default:
+			res, err = matchAlbum(relpath)
+			if err != nil {
+				return fmt.Errorf("stopped at %s (%d/%d): %w", relpath, i+1, len(albums), err)
+			}
+			if err := appendMatchResult(res); err != nil {
+				return err
+			}
+			fmt.Fprintf(progress, "[%d/%d] %s: %s\n", i+1, len(albums), relpath, res.Status)
+		}
+		counts[res.Status]++
+		report = append(report, res)
+	}
+
+	fmt.Fprintf(
+		progress,
+		"%d matched, %d ambiguous, %d not found, %d already mapped, %d errors\n",
+		counts[matchMatched],
+		counts[matchAmbiguous],
+		counts[matchNotFound],
+		counts[matchMapped],
+		counts[matchError],
+	)
+	return writeMatchReport(w, format, report)
+}
+
+// plaque discogs match -all [-o file] [-format tsv|json] [-restart]
+func matchCommand(args []string) error {
+	usage := errors.New("usage: plaque discogs match -all [flags]")
+
+	fset := flag.NewFlagSet("discogs match", flag.ContinueOnError)
+	all := fset.Bool("all", false, "match every album in the library")
+	out := fset.String("o", "", "report file (default: stdout)")
+	format := fset.String("format", "tsv", "tsv or json")
+	restart := fset.Bool("restart", false, "discard results of previous runs")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if !*all {
+		return usage
+	}
+	if *format != "tsv" && *format != "json" {
+		return fmt.Errorf("invalid format: %s", *format)
+	}
+	if *restart {
+		if err := os.Remove(matchResultsPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return matchLibrary(w, *format, os.Stderr)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"plaque/discogs"
+	"plaque/discogs/discogstest"
+)
+
+func TestMatchLibrary(t *testing.T) {
+	root, state, d := config.Library.Root, config.StateDir, discogs.Default
+	defer func() { config.Library.Root, config.StateDir, discogs.Default = root, state, d }()
+	config.Library.Root = t.TempDir()
+	config.StateDir = t.TempDir()
+
+	albums := map[string]int{ // number of tracks
+		"Metallica/Ride the Lightning (1984)": 8,
+		"Metallica/Ride the Lightning (1990)": 3, // some bootleg
+		"Pyrrhic Salvation/Demo":              1,
+		"natsumen/kill your winter (2018)":    1,
+		"Sunn O)))/Kannon":                    1,
+	}
+	for relpath, n := range albums {
+		dir := filepath.Join(config.Library.Root, relpath)
+		_ = os.MkdirAll(dir, 0755)
+		for i := range n {
+			_ = os.WriteFile(filepath.Join(dir, string(rune('a'+i))+".flac"), nil, 0644)
+		}
+	}
+
+	// interrupted at the first album; nothing is recorded
+	discogs.Default = discogs.NewClient("test", "")
+	discogs.Default.BaseURL = "http://127.0.0.1:1"
+	err := matchLibrary(io.Discard, "tsv", io.Discard)
+	assert.ErrorIs(t, err, discogs.ErrNetwork)
+	assert.Empty(t, readMatchResults())
+
+	discogs.Default = discogstest.NewClient(t, "discogs/testdata")
+	var report bytes.Buffer
+	assert.Nil(t, matchLibrary(&report, "tsv", io.Discard))
+	assert.Equal(t, strings.Split(report.String(), "\n"), []string{
+		"relpath\tstatus\tscore\turl",
+		"Metallica/Ride the Lightning (1984)\tmatched\t1.00\thttps://www.discogs.com/master/6440",
+		"Metallica/Ride the Lightning (1990)\tambiguous\t0.77\thttps://www.discogs.com/master/6440",
+		"Pyrrhic Salvation/Demo\tnot found\t\t",
+		"Sunn O)))/Kannon\tnot found\t\t",
+		"natsumen/kill your winter (2018)\tmatched\t1.00\thttps://www.discogs.com/release/12578164",
+		"",
+	})
+	assert.Len(t, readMapping().Albums, 2)
+
+	// ambiguous albums are matched again until mapped
+	discogs.Default = discogs.NewClient("test", "")
+	discogs.Default.BaseURL = "http://127.0.0.1:1"
+	err = matchLibrary(io.Discard, "tsv", io.Discard)
+	assert.ErrorContains(t, err, "stopped at Metallica/Ride the Lightning (1990)")
+	assert.Nil(t, editMapping("Metallica/Ride the Lightning (1990)", Albums, "release/377464"))
+
+	// errors are retried
+	assert.Nil(t, appendMatchResult(matchResult{Relpath: "Pyrrhic Salvation/Demo", Status: matchError}))
+	err = matchLibrary(io.Discard, "tsv", io.Discard)
+	assert.ErrorContains(t, err, "stopped at Pyrrhic Salvation/Demo")
+
+	// otherwise, resumed runs do not make any requests
+	assert.Nil(t, appendMatchResult(matchResult{Relpath: "Pyrrhic Salvation/Demo", Status: matchNotFound}))
+	report.Reset()
+	assert.Nil(t, matchLibrary(&report, "json", io.Discard))
+	var results []matchResult
+	assert.Nil(t, json.Unmarshal(report.Bytes(), &results))
+	assert.Len(t, results, 5)
+	assert.Equal(t, results[1].Status, matchMapped)
+	assert.Equal(t, results[2].Status, matchNotFound)
+}
@@ -0,0 +1,122 @@
+// Time-budget selection ("I have 45 minutes"). Queued albums that can be
+// played in full within the budget are proposed, either singly or as a pair of
+// short albums.
+
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reading durations requires opening every file of an album, so only the
+// highest-ranked items of the queue are considered.
+const budgetWindow = 100
+
+type proposal struct {
+	relpaths []string
+	total    time.Duration
+	rank     int // lower is better
+}
+
+// Accepts plain minutes ("45") or any Go duration ("1h30m")
+func parseBudget(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	if m, err := strconv.Atoi(s); err == nil && m > 0 {
+		return time.Duration(m) * time.Minute, true
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, true
+	}
+	return 0, false
+}
+
+// Given items that are already ranked (by the active sampler), return all
+// single items and pairs whose total duration fits within budget. Items
+// without a known duration are skipped.
+//
+// Proposals are ordered by the rank of their worst item; on ties, singles come
+// before pairs.
+func fitBudget(
+	budget time.Duration,
+	ranked []string,
+	durations map[string]time.Duration,
+) []proposal {
+	var props []proposal
+	for i, a := range ranked {
+		da, ok := durations[a]
+		if !ok || da == 0 || da > budget {
+			continue
+		}
+		props = append(props, proposal{relpaths: []string{a}, total: da, rank: i})
+
+		for _, b := range ranked[:i] {
+			db, ok := durations[b]
+			if !ok || db == 0 || da+db > budget {
+				continue
+			}
+			props = append(props, proposal{
+				relpaths: []string{b, a},
+				total:    da + db,
+				rank:     i,
+			})
+		}
+	}
+
+	slices.SortStableFunc(props, func(x proposal, y proposal) int {
+		if x.rank != y.rank {
+			return x.rank - y.rank
+		}
+		return len(x.relpaths) - len(y.relpaths)
+	})
+	return props
+}
+
+// Propose queued items that fit within budget. Returned items are unique and
+// ordered by their best proposal; previews describe the proposal.
+func budgetItems(budget time.Duration) ([]string, map[string][]string) {
+	defer timer("budget")()
+
+	ranked := activeSampler()(getQueue(0))
+	ranked = ranked[:min(budgetWindow, len(ranked))]
+
+	durations := make(map[string]time.Duration)
+	for _, r := range ranked {
+		d, err := albumDuration(r)
+		if err != nil {
+			log.Println("no duration:", r, err)
+			continue
+		}
+		durations[r] = d
+	}
+
+	var items []string
+	previews := make(map[string][]string)
+	for _, p := range fitBudget(budget, ranked, durations) {
+		for _, r := range p.relpaths {
+			if _, done := previews[r]; done {
+				continue
+			}
+			items = append(items, r)
+
+			pre := []string{fmtDuration(durations[r]) + " / " + fmtDuration(budget)}
+			if len(p.relpaths) > 1 {
+				other := p.relpaths[0]
+				if other == r {
+					other = p.relpaths[1]
+				}
+				pre = append(pre,
+					"+ "+other+" ("+fmtDuration(durations[other])+")",
+					"= "+fmtDuration(p.total),
+				)
+			}
+			tracks, _ := descend(filepath.Join(config.Library.Root, r))
+			previews[r] = append(append(pre, ""), tracks...)
+		}
+	}
+	return items, previews
+}
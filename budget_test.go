@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudget(t *testing.T) {
+	d, ok := parseBudget("45")
+	assert.True(t, ok)
+	assert.Equal(t, d, 45*time.Minute)
+	d, _ = parseBudget("1h30m")
+	assert.Equal(t, d, 90*time.Minute)
+	_, ok = parseBudget("foo")
+	assert.False(t, ok)
+
+	durs := map[string]time.Duration{
+		"a": 50 * time.Minute, // too long
+		"b": 40 * time.Minute,
+		"c": 20 * time.Minute,
+		"d": 25 * time.Minute,
+		// "e" has no duration
+	}
+	var got [][]string
+	for _, p := range fitBudget(45*time.Minute, []string{"a", "b", "c", "e", "d"}, durs) {
+		got = append(got, p.relpaths)
+	}
+	assert.Equal(t, got, [][]string{{"b"}, {"c"}, {"d"}, {"c", "d"}})
+
+	assert.Equal(t, fmtDuration(42*time.Minute+10*time.Second), "42:10")
+	assert.Equal(t, fmtDuration(time.Hour+2*time.Minute+3*time.Second), "1:02:03")
+}
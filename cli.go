@@ -0,0 +1,139 @@
+// Non-interactive subcommands, e.g. `plaque history export`. Each subcommand
+// parses its own flags.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"plaque/discogs"
+)
+
+var commands = map[string]func(args []string) error{
+	"cache":   cacheCommand,
+	"discogs": discogsCommand,
+	"history": historyCommand,
+	"trash":   trashCommand,
+}
+
+func runCommand(args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		names := slices.Sorted(maps.Keys(commands))
+		return fmt.Errorf("unknown command: %s (available: %s)", args[0], strings.Join(names, ", "))
+	}
+	return cmd(args[1:])
+}
+
+// plaque cache clear
+func cacheCommand(args []string) error {
+	if len(args) == 0 || args[0] != "clear" {
+		return errors.New("usage: plaque cache clear")
+	}
+	if discogs.Default.Cache == nil {
+		return errors.New("discogs cache is not enabled")
+	}
+	n, err := discogs.Default.Cache.Clear()
+	fmt.Println("Removed", n, "cached responses")
+	return err
+}
+
+// plaque discogs match|sync [flags]
+func discogsCommand(args []string) error {
+	if !discogsEnabled {
+		return errors.New("discogs is not configured")
+	}
+	if len(args) == 0 {
+		return errors.New("usage: plaque discogs match|sync")
+	}
+	switch args[0] {
+	case "match":
+		return matchCommand(args[1:])
+	case "sync":
+		return syncCommand(args[1:])
+	default:
+		return fmt.Errorf("invalid discogs command: %s", args[0])
+	}
+}
+
+// plaque discogs sync [-list] [-force] [-discard]
+//
+// Unless only listing or discarding, the local mirror is also refreshed.
+func syncCommand(args []string) error {
+	fset := flag.NewFlagSet("discogs sync", flag.ContinueOnError)
+	list := fset.Bool("list", false, "only list pending ratings")
+	force := fset.Bool("force", false, "overwrite conflicting ratings on Discogs")
+	discard := fset.Bool("discard", false, "drop conflicting ratings, keeping those on Discogs")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	if *list || *discard {
+		pending, err := discogs.Default.Outbox.Pending()
+		if err != nil {
+			return err
+		}
+		for _, p := range pending {
+			switch {
+			case *list:
+				fmt.Printf("%s\t%d\t%s\t%s\n", p.Time.Format(time.DateTime), p.Rating, p.Title, p.Error)
+			case p.Conflict != 0:
+				if err := discogs.Default.Outbox.Discard(p.ReleaseId); err != nil {
+					return err
+				}
+				fmt.Println("Discarded", p.Title)
+			}
+		}
+		return nil
+	}
+
+	res, err := discogs.Sync(*force)
+	fmt.Println("Delivered", len(res.Delivered), "ratings")
+	for _, p := range res.Conflicts {
+		fmt.Printf(
+			"Conflict: %s (release/%d) was rated %d, but is rated %d on Discogs\n",
+			p.Title,
+			p.ReleaseId,
+			p.Rating,
+			p.Conflict,
+		)
+	}
+	if len(res.Conflicts) > 0 {
+		fmt.Println("Use -force to overwrite, or -discard to keep the ratings on Discogs")
+	}
+	if len(res.Failed) > 0 {
+		fmt.Println(len(res.Failed), "ratings could not be delivered")
+	}
+	if err != nil {
+		return err
+	}
+
+	n, err := refreshMirror(true)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Mirrored", n, "releases")
+	return nil
+}
+
+// Deliver ratings that could not be delivered earlier. Conflicts are left for
+// `plaque discogs sync`.
+func syncOutbox() {
+	if !discogsEnabled {
+		return
+	}
+	res, err := discogs.Sync(false)
+	if err != nil {
+		log.Println("could not sync ratings:", err)
+	}
+	if n := len(res.Delivered) + len(res.Conflicts) + len(res.Failed); n > 0 {
+		log.Println("synced ratings:", len(res.Delivered), "delivered,", len(res.Conflicts), "conflicts,", len(res.Failed), "failed")
+	}
+}
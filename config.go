@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/spf13/viper"
@@ -16,13 +17,50 @@ import (
 
 var (
 	config *struct {
+		NQueue   int    // number of items to sample in Queue mode
+		Sampler  string // see samplers
+		StateDir string `mapstructure:"state_dir"` // history, etc
+
 		Library struct {
 			Root  string
 			Queue string
 		}
 		Playback struct {
-			Before string // arbitrary command to be invoked before playback
-			// After  string
+			// arbitrary command to be invoked before playback.
+			// deprecated: use hooks.before-play instead
+			Before string
+			// whether to remove albums from queue after playback,
+			// based on progress: always (default), heard, played
+			Dequeue string
+			// post-playback steps, in order (see steps.go). default:
+			// dequeue, rate, delete, browse
+			Steps []string
+			// when playback will be resumed: quit (default), or
+			// return to queue
+			OnResume string `mapstructure:"on_resume"`
+		}
+		Hooks  map[string]hook // keys: BeforePlay, etc
+		Events struct {
+			Sink string // see events.go
+		}
+		Player struct {
+			Backend string // mpv (default), mpd, command, null
+			// for command backend, e.g. "ffplay -nodisp -autoexit {{.Path}}"
+			Command string
+		}
+		Mpd struct {
+			Address  string // host:port, or path to unix socket
+			Password string
+			// Library.Root, relative to mpd's music directory. empty if
+			// both are the same
+			MusicDir string `mapstructure:"music_dir"`
+			Append   bool   // add to playlist instead of clearing it
+		}
+		Trash struct {
+			// default: XDG home trash. must be on the same filesystem
+			// as Library.Root
+			Dir        string
+			PurgeAfter time.Duration `mapstructure:"purge_after"` // 0: never
 		}
 		Mpv struct {
 			Args string
@@ -91,6 +129,10 @@ func init() {
 	x.SetConfigName("config")
 	x.SetConfigType("toml")
 
+	x.SetDefault("nqueue", QueueCount)
+	x.SetDefault("state_dir", filepath.Join(xdgStateHome(), "plaque"))
+	x.SetDefault("sampler", "random")
+	x.SetDefault("mpd.address", "localhost:6600")
 	x.SetDefault("mpv.args", "--mute=no --no-audio-display --pause=no --start=0%")
 	x.SetDefault("mpv.watch_later_dir", os.ExpandEnv("$HOME/.local/state/mpv/watch_later"))
 
@@ -129,7 +171,27 @@ func init() {
 		config.Library.Queue = abs
 	}
 
+	if config.Playback.Before != "" {
+		if config.Hooks == nil {
+			config.Hooks = make(map[string]hook)
+		}
+		if _, ok := config.Hooks[BeforePlay]; !ok {
+			config.Hooks[BeforePlay] = hook{Cmd: config.Playback.Before}
+		}
+	}
+
+	for _, s := range config.Playback.Steps {
+		if _, ok := steps[s]; !ok {
+			log.Fatalln("invalid playback step:", s)
+		}
+	}
+
+	player = newPlayer(config.Player.Backend)
+
 	discogsEnabled = discogs.Config != nil &&
 		discogs.Config.Username != "" &&
 		discogs.Config.Key != ""
+	if discogsEnabled {
+		discogs.Default.Outbox = discogs.NewOutbox(filepath.Join(config.StateDir, "discogs_outbox.json"))
+	}
 }
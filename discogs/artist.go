@@ -1,10 +1,10 @@
 package discogs
 
 import (
-	"log"
+	"context"
+	"iter"
 	"net/url"
 	"strconv"
-	"strings"
 )
 
 type Artist struct {
@@ -19,10 +19,36 @@ type Artist struct {
 	Title string // search-only
 }
 
-// Returns artist releases (which are not full releases)
+const releasesPerPage = 100
+
+// Returns all artist releases (which are not full releases). For prolific
+// artists, prefer IterReleases.
 //
 // Requires GET
-func (a Artist) Releases() []Release {
+func (a Artist) Releases() ([]Release, error) { return Default.Releases(a) }
+
+// Artist releases, fetched one page at a time as needed
+func (a Artist) IterReleases() iter.Seq2[Release, error] { return Default.IterReleases(a) }
+
+func (c *Client) Releases(a Artist) ([]Release, error) {
+	var releases []Release
+	for r, err := range c.IterReleases(a) {
+		if err != nil {
+			return releases, err
+		}
+		releases = append(releases, r)
+	}
+	return releases, nil
+}
+
+func (c *Client) IterReleases(a Artist) iter.Seq2[Release, error] {
+	return paginate(func(page int) ([]Release, Pagination, error) {
+		return c.ReleasesPage(a, page)
+	})
+}
+
+// A single page of artist releases (starting from 1)
+func (c *Client) ReleasesPage(a Artist, page int) ([]Release, Pagination, error) {
 	// /artists/{a.id}/releases
 	urlpath, _ := url.JoinPath(
 		"artists",
@@ -30,42 +56,19 @@ func (a Artist) Releases() []Release {
 		"releases",
 	)
 
-	resp := makeReq(
+	data, err := deserialize[struct {
+		Pagination Pagination
+		Releases   []Release
+	}](c.makeReq(
+		context.Background(),
 		urlpath,
 		"GET",
 		// yes, the numbers need to be strings...
 		map[string]any{
 			"sort":     "year",
-			"per_page": "100",
-			"page":     "1",
+			"per_page": strconv.Itoa(releasesPerPage),
+			"page":     strconv.Itoa(page),
 		},
-	)
-	return deserialize(resp, struct {
-		Releases []Release
-	}{}).Releases
-}
-
-var IgnoredFormats = map[string]any{
-	// maps are var-only
-
-	"Compilation": nil,
-	"DVD-V":       nil,
-	"Shellac":     nil,
-	"Single":      nil,
-}
-
-// Currently only supports artist releases. Note that this tends to produce
-// false negatives, because the Formats field of an artist release tends to be
-// empty, and we avoid a GET of the primary release for now.
-func (r *Release) ignored() bool {
-	log.Println(r.Formats)
-	for _, format := range strings.Split(r.Formats, ", ") {
-		// fmts := r.Formats[0]["descriptions"].([]string)
-		// for _, format := range fmts {
-		if _, ig := IgnoredFormats[format]; ig {
-			return true
-		}
-	}
-	// TODO: fetch actual release
-	return false
+	))
+	return data.Releases, data.Pagination, err
 }
@@ -0,0 +1,152 @@
+// On-disk cache of GET responses. Entries are keyed by URL, and are fresh for
+// a TTL that depends on the endpoint; stale entries are revalidated with
+// ETag/Last-Modified, if the server supplied them (or served as is, if the
+// server is unreachable). Cache hits do not count towards the rate limit;
+// revalidations do, but are at least small.
+
+package discogs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// First match (against the url path, without leading slash) wins. Endpoints
+// that do not match are never cached; a TTL of 0 likewise disables caching.
+var CacheTTLs = []struct {
+	Pattern *regexp.Regexp
+	TTL     time.Duration
+}{
+	{regexp.MustCompile(`^releases/\d+/rating/`), 0}, // changes when we rate
+	{regexp.MustCompile(`^database/search`), day},
+	{regexp.MustCompile(`^artists/`), 7 * day},
+	{regexp.MustCompile(`^masters/`), 30 * day},
+	{regexp.MustCompile(`^releases/`), 30 * day},
+}
+
+type Cache struct{ dir string }
+
+func NewCache(dir string) *Cache { return &Cache{dir: dir} }
+
+// Default location of the cache, i.e. $XDG_CACHE_HOME/plaque/discogs
+func DefaultCacheDir() string {
+	d, err := os.UserCacheDir()
+	if err != nil {
+		d = os.TempDir()
+	}
+	return filepath.Join(d, "plaque", "discogs")
+}
+
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Body         []byte    `json:"body"`
+}
+
+func (c *Cache) file(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *Cache) get(u string) *cacheEntry {
+	b, err := os.ReadFile(c.file(u))
+	if err != nil {
+		return nil
+	}
+	var e cacheEntry
+	if json.Unmarshal(b, &e) != nil || e.URL != u {
+		return nil
+	}
+	return &e
+}
+
+func (c *Cache) put(e *cacheEntry) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.file(e.URL), b, 0644)
+}
+
+// Remove all entries. Returns the number of entries removed.
+func (c *Cache) Clear() (int, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+	for i, f := range files {
+		if err := os.Remove(f); err != nil {
+			return i, err
+		}
+	}
+	return len(files), nil
+}
+
+type noCacheKey struct{}
+
+// Requests made with the returned context always go to the server (and their
+// responses are not stored)
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// How long the response to a request may be cached for; 0 if it should not be
+// cached at all
+func (c *Client) cacheTTL(ctx context.Context, method string, u *url.URL) time.Duration {
+	if c.Cache == nil || method != "GET" || ctx.Value(noCacheKey{}) != nil {
+		return 0
+	}
+	p := strings.TrimPrefix(u.Path, "/")
+	for _, t := range CacheTTLs {
+		if t.Pattern.MatchString(p) {
+			return t.TTL
+		}
+	}
+	return 0
+}
+
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(e.Body)),
+		Request:    req,
+	}
+}
+
+// Read the body of a successful response into the cache. The body is replaced,
+// so resp can still be read as usual.
+func (c *Cache) store(u string, resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return c.put(&cacheEntry{
+		URL:          u,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+		Body:         body,
+	})
+}
@@ -0,0 +1,70 @@
+package discogs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	var hits, revalidated int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidated++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`{"id": 1, "title": "x"}`))
+	}))
+	defer s.Close()
+
+	c := NewClient("test", "")
+	c.BaseURL = s.URL
+	c.Cache = NewCache(t.TempDir())
+
+	get := func(ctx context.Context, urlpath string) Release {
+		r, err := deserialize[Release](c.makeReq(ctx, urlpath, "GET", nil))
+		assert.Nil(t, err)
+		return r
+	}
+
+	ctx := context.Background()
+	assert.Equal(t, get(ctx, "/releases/1").Title, "x")
+	assert.Equal(t, get(ctx, "/releases/1").Title, "x")
+	assert.Equal(t, hits, 1)
+
+	// stale
+	u := s.URL + "/releases/1"
+	e := c.Cache.get(u)
+	e.Fetched = time.Now().Add(-365 * day)
+	_ = c.Cache.put(e)
+	assert.Equal(t, get(ctx, "/releases/1").Title, "x")
+	assert.Equal(t, revalidated, 1)
+	assert.Less(t, time.Since(c.Cache.get(u).Fetched), time.Minute)
+
+	// not cached
+	get(ctx, "/releases/1/rating/test")
+	get(ctx, "/releases/1/rating/test")
+	get(WithoutCache(ctx), "/releases/1")
+	assert.Equal(t, hits, 5)
+
+	// stale, and unreachable
+	e = c.Cache.get(u)
+	e.Fetched = time.Now().Add(-365 * day)
+	_ = c.Cache.put(e)
+	s.Close()
+	assert.Equal(t, get(ctx, "/releases/1").Title, "x")
+	_, err := c.makeReq(ctx, "/releases/2", "GET", nil)
+	assert.ErrorIs(t, err, ErrNetwork)
+
+	n, err := c.Cache.Clear()
+	assert.Nil(t, err)
+	assert.Equal(t, n, 1)
+	assert.Nil(t, c.Cache.get(u))
+}
@@ -0,0 +1,60 @@
+package discogs
+
+import (
+	"context"
+	"iter"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const collectionPerPage = 100
+
+// An instance of a release in the user's collection. A release may be
+// collected more than once (e.g. in different folders).
+type CollectionItem struct {
+	Id         int       // of the release
+	InstanceId int       `json:"instance_id"`
+	FolderId   int       `json:"folder_id"`
+	Rating     int       // 0 if not rated
+	DateAdded  time.Time `json:"date_added"`
+
+	// Id, MasterId, Title, Year, Artists and Formats only
+	BasicInformation Release `json:"basic_information"`
+}
+
+// All items in the user's collection (i.e. folder 0), fetched one page at a
+// time as needed
+func IterCollection() iter.Seq2[CollectionItem, error] { return Default.IterCollection() }
+
+func (c *Client) IterCollection() iter.Seq2[CollectionItem, error] {
+	return paginate(func(page int) ([]CollectionItem, Pagination, error) {
+		return c.CollectionPage(0, page)
+	})
+}
+
+// A single page of a collection folder (starting from 1). Folder 0 contains
+// all items.
+func (c *Client) CollectionPage(folder int, page int) ([]CollectionItem, Pagination, error) {
+	// users/{username}/collection/folders/{folder}/releases
+	urlpath, _ := url.JoinPath(
+		"users",
+		c.Username,
+		"collection/folders",
+		strconv.Itoa(folder),
+		"releases",
+	)
+	data, err := deserialize[struct {
+		Pagination Pagination
+		Releases   []CollectionItem
+	}](c.makeReq(
+		context.Background(),
+		urlpath,
+		"GET",
+		map[string]any{
+			"per_page": strconv.Itoa(collectionPerPage),
+			"page":     strconv.Itoa(page),
+		},
+	))
+	return data.Releases, data.Pagination, err
+}
@@ -0,0 +1,28 @@
+package discogs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"plaque/discogs"
+)
+
+func TestCollection(t *testing.T) {
+	useFixtures(t)
+
+	var items []discogs.CollectionItem
+	for item, err := range discogs.IterCollection() {
+		assert.Nil(t, err)
+		items = append(items, item)
+	}
+	assert.Len(t, items, 2)
+	assert.Equal(t, items[0].Rating, 4)
+	assert.Equal(t, items[0].BasicInformation.MasterId, 6440)
+	assert.Equal(t, items[0].BasicInformation.Formats[0].String(), "Vinyl, LP, Album")
+	assert.Equal(t, items[1].Rating, 0)
+
+	rating, err := discogs.GetRating(377464)
+	assert.Nil(t, err)
+	assert.Equal(t, rating, 0)
+}
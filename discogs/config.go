@@ -15,6 +15,11 @@ var Config *struct {
 	Username   string
 	Key        string
 	MaxResults int
+
+	// replaces the default IgnoredFormats, if set
+	IgnoredFormats []string `mapstructure:"ignored_formats"`
+
+	MatchThreshold float64 `mapstructure:"match_threshold"`
 }
 
 func init() {
@@ -27,9 +32,11 @@ func init() {
 	viper.SetConfigName("config")
 	viper.SetConfigType("toml")
 
+	// without config, Discogs is simply unavailable (Config remains nil)
 	err := viper.ReadInConfig()
 	if err != nil {
-		panic("No config found")
+		log.Println("no discogs config:", err)
+		return
 	}
 
 	if err := viper.Unmarshal(&Config); err != nil {
@@ -41,6 +48,21 @@ func init() {
 	// 	Config.MaxResults = 10
 	// }
 
+	Default = NewClient(Config.Username, Config.Key)
+	Default.Cache = NewCache(DefaultCacheDir())
+	if Config.MaxResults > 0 {
+		Default.MaxResults = Config.MaxResults
+	}
+	if Config.MatchThreshold > 0 {
+		MatchThreshold = Config.MatchThreshold
+	}
+	if Config.IgnoredFormats != nil {
+		IgnoredFormats = make(map[string]any, len(Config.IgnoredFormats))
+		for _, f := range Config.IgnoredFormats {
+			IgnoredFormats[f] = nil
+		}
+	}
+
 	if Config.Key == "" {
 		log.Println("no key")
 		return
@@ -2,13 +2,65 @@ package discogs
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 )
 
-const ApiPrefix = "https://api.discogs.com"
+const (
+	ApiPrefix = "https://api.discogs.com"
+	// Discogs requires a User-Agent that identifies the application
+	// https://www.discogs.com/developers/#page:home,header:home-general-information
+	UserAgent = "plaque +https://github.com/hejops/plaque"
+)
+
+const (
+	// unauthenticated requests are limited to 25 per minute, but we always
+	// authenticate
+	defaultRateLimit = 60
+	maxRetries       = 4
+	retryBackoff     = time.Second // doubled on every retry
+)
+
+// Timeout of a single request (including retries)
+var RequestTimeout = time.Minute
+
+// All requests are made through a Client. Fields may be changed before first
+// use, e.g. to point BaseURL at a test server.
+type Client struct {
+	BaseURL    string
+	HTTP       *http.Client
+	UserAgent  string
+	Username   string
+	Key        string   // personal access token
+	MaxResults int      // of search results to consider in Primary
+	Cache      *Cache   // nil to disable caching
+	Outbox     *Outbox  // nil to deliver ratings directly
+	Prompt     Prompter // nil for PromptRating
+
+	limiter *limiter
+}
+
+func NewClient(username string, key string) *Client {
+	return &Client{
+		BaseURL:    ApiPrefix,
+		HTTP:       http.DefaultClient,
+		UserAgent:  UserAgent,
+		Username:   username,
+		Key:        key,
+		MaxResults: 5,
+		limiter:    newLimiter(defaultRateLimit),
+	}
+}
+
+// Used by the package-level functions (and methods of Artist, Release, etc).
+// Initialised from Config, if any; otherwise it has no credentials.
+var Default = NewClient("", "")
 
 // urlpath -cannot- contain query params; these should be passed as data
 // instead.
@@ -16,7 +68,19 @@ const ApiPrefix = "https://api.discogs.com"
 // data should either be GET query params (in which case all values must be
 // strings), or PUT json data (in which case values must be correctly typed by
 // the caller).
-func makeReq(urlpath string, method string, data map[string]any) *http.Response {
+//
+// Requests are rate limited, and retried with exponential backoff when rate
+// limited (429) or on server errors (5xx). GET responses may be cached; see
+// CacheTTLs.
+//
+// Any failure (including unsuccessful status codes) is returned as a
+// *RequestError; the response body only needs to be closed if err is nil.
+func (c *Client) makeReq(
+	ctx context.Context,
+	urlpath string,
+	method string,
+	data map[string]any,
+) (*http.Response, error) {
 	// urlpath must be a string (not Url) to make it easy for callers.
 	// however, because urlpaths that contain query will be joined with
 	// undesirable escape ("?" -> "%3f"), queries have to be added
@@ -28,13 +92,15 @@ func makeReq(urlpath string, method string, data map[string]any) *http.Response
 		panic("empty urlpath!")
 	}
 
-	u, _ := url.Parse(ApiPrefix)
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		panic(err)
+	}
 	u = u.JoinPath(urlpath)
 
-	// map -> []byte -> bytes.Buffer
+	// map -> []byte
 
-	var req *http.Request
-	var err error
+	var body []byte
 
 	switch method {
 
@@ -46,34 +112,136 @@ func makeReq(urlpath string, method string, data map[string]any) *http.Response
 			}
 			u.RawQuery = query.Encode()
 		}
-		req, err = http.NewRequest(method, u.String(), nil)
 
 	case "PUT":
-		b, mErr := json.Marshal(data)
-		if mErr != nil {
-			panic(mErr)
+		b, err := json.Marshal(data)
+		if err != nil {
+			panic(err)
 		}
-		// https://stackoverflow.com/a/24455606
-		req, err = http.NewRequest(method, u.String(), bytes.NewBuffer(b))
-		req.Header.Set("Content-Type", "application/json")
+		body = b
 
 	default:
 		panic("invalid method")
 
 	}
 
-	if err != nil {
-		panic(err)
+	ttl := c.cacheTTL(ctx, method, u)
+	var entry *cacheEntry
+	if ttl > 0 {
+		entry = c.Cache.get(u.String())
+	}
+	if entry != nil && time.Since(entry.Fetched) < ttl {
+		log.Println("cached:", method, u.RequestURI())
+		req, _ := http.NewRequestWithContext(ctx, method, u.String(), nil)
+		return entry.response(req), nil
 	}
 
-	req.Header.Set("Authorization", "Discogs token="+Config.Key)
-	req.Header.Set("Cache-Control", "no-cache")
+	// the body is read after we return, so the context can only be
+	// cancelled once it is closed
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	fail := func(kind error, status int, err error) (*http.Response, error) {
+		cancel()
+		return nil, &RequestError{Kind: kind, Method: method, Path: u.Path, Status: status, Err: err}
+	}
 
-	log.Println(method, u.RequestURI())
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.wait(ctx); err != nil {
+			return fail(ErrNetwork, 0, err)
+		}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		panic(err)
+		// a request (and its body) cannot be reused
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			panic(err)
+		}
+		if method == "PUT" {
+			// https://stackoverflow.com/a/24455606
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Authorization", "Discogs token="+c.Key)
+		req.Header.Set("Cache-Control", "no-cache")
+		req.Header.Set("User-Agent", c.UserAgent)
+		if entry != nil { // stale; revalidate
+			if entry.ETag != "" {
+				req.Header.Set("If-None-Match", entry.ETag)
+			}
+			if entry.LastModified != "" {
+				req.Header.Set("If-Modified-Since", entry.LastModified)
+			}
+		}
+
+		log.Println(method, u.RequestURI())
+
+		resp, err := c.HTTP.Do(req)
+		if err != nil && entry != nil {
+			// stale is better than nothing, e.g. for rating offline
+			log.Println("unreachable, using stale:", method, u.RequestURI())
+			cancel()
+			return entry.response(req), nil
+		}
+		if err != nil {
+			return fail(ErrNetwork, 0, err)
+		}
+		c.limiter.update(resp.Header)
+
+		if resp.StatusCode == http.StatusNotModified && entry != nil {
+			resp.Body.Close()
+			cancel()
+			entry.Fetched = time.Now()
+			if err := c.Cache.put(entry); err != nil {
+				log.Println("could not cache:", err)
+			}
+			return entry.response(req), nil
+		}
+
+		if !retryable(resp.StatusCode) || attempt == maxRetries {
+			if kind := statusError(resp.StatusCode); kind != nil {
+				resp.Body.Close()
+				return fail(kind, resp.StatusCode, nil)
+			}
+			if ttl > 0 {
+				if err := c.Cache.store(u.String(), resp); err != nil {
+					log.Println("could not cache:", err)
+				}
+			}
+			resp.Body = cancelOnClose{resp.Body, cancel}
+			return resp, nil
+		}
+
+		// drain body to allow connection reuse
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		wait := backoff
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			wait = time.Duration(s) * time.Second
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			c.limiter.drain()
+		}
+		log.Println("retrying in", wait, resp.Status)
+
+		select {
+		case <-ctx.Done():
+			return fail(ErrNetwork, resp.StatusCode, ctx.Err())
+		case <-time.After(wait):
+		}
+		backoff *= 2
 	}
-	return resp
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// Release the request's context once the response has been read
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
 }
@@ -0,0 +1,54 @@
+package discogs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Kinds of request failure; match with errors.Is
+var (
+	ErrNetwork     = errors.New("Discogs unreachable")
+	ErrAuth        = errors.New("Discogs authentication failed")
+	ErrRateLimited = errors.New("Discogs rate limit exceeded")
+	ErrDecode      = errors.New("Failed to decode Discogs response")
+	// ErrNotFound is also used for requests that 404
+)
+
+// Returned for any failed request. Use errors.As to get at the details.
+type RequestError struct {
+	Kind   error // one of the above, or ErrNotFound
+	Method string
+	Path   string
+	Status int   // 0 if no response was received
+	Err    error // underlying error; may be nil
+}
+
+func (e *RequestError) Error() string {
+	s := fmt.Sprintf("%s %s: %s", e.Method, e.Path, e.Kind)
+	if e.Status != 0 {
+		s += fmt.Sprintf(" (%d)", e.Status)
+	}
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+func (e *RequestError) Unwrap() []error { return []error{e.Kind, e.Err} }
+
+// Classify an unsuccessful status code. Returns nil for 2xx.
+func statusError(status int) error {
+	switch {
+	case status < 300:
+		return nil
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	default:
+		return ErrNetwork
+	}
+}
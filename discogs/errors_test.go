@@ -0,0 +1,27 @@
+package discogs
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors(t *testing.T) {
+	assert.Nil(t, statusError(200))
+	assert.Equal(t, statusError(401), ErrAuth)
+	assert.Equal(t, statusError(404), ErrNotFound)
+	assert.Equal(t, statusError(429), ErrRateLimited)
+	assert.Equal(t, statusError(503), ErrNetwork)
+
+	var err error = &RequestError{Kind: ErrDecode, Method: "GET", Path: "/x", Status: 200, Err: io.ErrUnexpectedEOF}
+	assert.ErrorIs(t, err, ErrDecode)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.NotErrorIs(t, err, ErrNetwork)
+
+	var re *RequestError
+	assert.True(t, errors.As(err, &re))
+	assert.Equal(t, re.Status, 200)
+	assert.Equal(t, err.Error(), "GET /x: Failed to decode Discogs response (200): unexpected EOF")
+}
@@ -0,0 +1,159 @@
+// Matching of local albums to Discogs releases. Search results are only
+// candidates; each is fetched in full (as a master, if it has one), and scored
+// against what is known about the local album.
+
+package discogs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Matches scoring below this should be confirmed by the user. Can be set with
+// match_threshold in the config.
+var MatchThreshold = 0.8
+
+// What is known about an album in the library. Zero values are unknown, and
+// are not scored.
+type Local struct {
+	Artist   string
+	Title    string
+	Year     int
+	Tracks   int
+	Duration time.Duration
+}
+
+type Match struct {
+	Release Release // master, if the release has one
+	Score   float64 // 0 to 1
+}
+
+func (m Match) Confident() bool { return m.Score >= MatchThreshold }
+
+func (m Match) String() string {
+	s := fmt.Sprintf("[%.2f] %d :: %s :: %s", m.Score, m.Release.Year, m.Release.artistName(), m.Release.Title)
+	if n := len(m.Release.tracks()); n > 0 {
+		s += fmt.Sprintf(" (%d tracks", n)
+		if d := m.Release.duration(); d > 0 {
+			s += ", " + d.String()
+		}
+		s += ")"
+	}
+	return s
+}
+
+// Discogs disambiguates artists of the same name with a numeric suffix, e.g.
+// "Nirvana (2)"
+var artistSuffix = regexp.MustCompile(` \(\d+\)$`)
+
+// Relative contribution of each criterion to the score
+var matchWeights = struct {
+	Artist, Title, Year, Tracks, Duration float64
+}{0.3, 0.3, 0.1, 0.15, 0.15}
+
+// 1 if equal, 0 if they differ by (at least) tol, relative to the larger
+func closeness(a float64, b float64, tol float64) float64 {
+	if a == b {
+		return 1
+	}
+	return max(0, 1-abs(a-b)/max(a, b)/tol)
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Confidence (0 to 1) that r is the local album. Criteria that are unknown on
+// either side are left out, so a release without tracklist is scored on its
+// artist, title and year alone.
+func (l Local) Score(r Release) float64 {
+	var score, total float64
+	add := func(weight float64, s float64) {
+		score += weight * s
+		total += weight
+	}
+
+	var artist float64
+	for _, a := range r.Artists {
+		artist = max(artist, similarity(l.Artist, artistSuffix.ReplaceAllString(a.Name, "")))
+	}
+	if r.ArtistsSort != "" {
+		artist = max(artist, similarity(l.Artist, r.ArtistsSort))
+	}
+	add(matchWeights.Artist, artist)
+	add(matchWeights.Title, similarity(l.Title, r.Title))
+
+	if l.Year > 0 && r.Year > 0 {
+		// reissues are usually much later, remasters even more so
+		d := abs(float64(l.Year - r.Year))
+		add(matchWeights.Year, max(0, 1-d/5))
+	}
+	if n := len(r.tracks()); l.Tracks > 0 && n > 0 {
+		add(matchWeights.Tracks, closeness(float64(l.Tracks), float64(n), 1))
+	}
+	if d := r.duration(); l.Duration > 0 && d > 0 {
+		// 2% off (e.g. different gaps) is still 0.9
+		add(matchWeights.Duration, closeness(l.Duration.Seconds(), d.Seconds(), 0.2))
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return score / total
+}
+
+// Candidates for l, best first. Only the first MaxResults search results are
+// considered; releases sharing a master are considered once. If nothing is
+// found, returns ErrNotFound.
+func Matches(l Local) ([]Match, error) { return Default.Matches(l) }
+
+func (c *Client) Matches(l Local) ([]Match, error) {
+	res, err := c.Search(l.Artist, l.Title)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	seen := make(map[string]bool)
+	for i, r := range res.Results {
+		if i >= c.MaxResults {
+			break
+		}
+		path := "/releases/" + strconv.Itoa(r.Id)
+		if r.MasterId > 0 {
+			path = "/masters/" + strconv.Itoa(r.MasterId)
+		}
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		full, err := deserialize[Release](c.makeReq(context.Background(), path, "GET", nil))
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, Match{Release: full, Score: l.Score(full)})
+	}
+	if len(matches) == 0 {
+		return nil, ErrNotFound
+	}
+
+	slices.SortStableFunc(matches, func(a, b Match) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return matches, nil
+}
@@ -0,0 +1,43 @@
+package discogs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"plaque/discogs"
+)
+
+func TestMatches(t *testing.T) {
+	useFixtures(t)
+
+	rtl := discogs.Local{
+		Artist:   "Metallica",
+		Title:    "Ride the Lightning",
+		Year:     1984,
+		Tracks:   8,
+		Duration: 47*time.Minute + 19*time.Second,
+	}
+	matches, err := discogs.Matches(rtl)
+	assert.Nil(t, err)
+	// both results share a master
+	assert.Len(t, matches, 1)
+	assert.Equal(t, matches[0].Release.Id, 6440)
+	assert.Equal(t, matches[0].Score, 1.0)
+	assert.True(t, matches[0].Confident())
+
+	// a bootleg with a few bonus tracks
+	rtl.Tracks, rtl.Duration, rtl.Year = 11, time.Hour, 1989
+	matches, _ = discogs.Matches(rtl)
+	assert.Less(t, matches[0].Score, discogs.MatchThreshold)
+
+	// without master; no tracklist, so only artist, title and year count
+	matches, err = discogs.Matches(discogs.Local{Artist: "natsumen", Title: "kill your winter", Tracks: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, matches[0].Release.Id, 12578164)
+	assert.True(t, matches[0].Confident())
+
+	_, err = discogs.Matches(discogs.Local{Artist: "Pyrrhic Salvation", Title: "Demo"})
+	assert.ErrorIs(t, err, discogs.ErrNotFound)
+}
@@ -0,0 +1,244 @@
+// Outbox of ratings. A rating made in Rate is written to the outbox before it
+// is delivered (i.e. the rating is PUT, and the release is added to the
+// collection); if delivery fails, e.g. because Discogs is unreachable, the
+// rating remains in the outbox, and is delivered by a later Sync. If Discogs
+// is already unreachable when rating, the prompt is shown with whatever is
+// known about the release (e.g. from the cache), and the rating is queued.
+//
+// Since some time may pass before a Sync, the release may have been rated
+// (differently) on Discogs in the meantime. Such conflicts are not
+// overwritten, unless forced.
+
+package discogs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrConflict = errors.New("Release already rated differently")
+
+type Pending struct {
+	ReleaseId int       `json:"release_id"`
+	Title     string    `json:"title"` // for display only
+	Rating    int       `json:"rating"`
+	Time      time.Time `json:"time"`
+
+	Rated     bool   `json:"rated"`              // rating was delivered
+	Collected bool   `json:"collected"`          // release was added to collection
+	Conflict  int    `json:"conflict,omitempty"` // rating found on Discogs
+	Attempts  int    `json:"attempts"`
+	Error     string `json:"error,omitempty"` // of the last attempt
+}
+
+func (p *Pending) done() bool { return p.Rated && p.Collected }
+
+// Pending ratings, kept in a json file. Safe for concurrent use within a
+// process.
+type Outbox struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewOutbox(path string) *Outbox { return &Outbox{path: path} }
+
+func (o *Outbox) read() ([]Pending, error) {
+	var pending []Pending
+	b, err := os.ReadFile(o.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pending, json.Unmarshal(b, &pending)
+}
+
+func (o *Outbox) write(pending []Pending) error {
+	if err := os.MkdirAll(filepath.Dir(o.path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(pending, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(o.path, b, 0644)
+}
+
+// All pending ratings, oldest first
+func (o *Outbox) Pending() ([]Pending, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.read()
+}
+
+// Add or replace (in place) the entry of the same release; done entries are
+// removed
+func (o *Outbox) put(p Pending) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	pending, err := o.read()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(pending, func(q Pending) bool { return q.ReleaseId == p.ReleaseId })
+	switch {
+	case i >= 0 && p.done():
+		pending = slices.Delete(pending, i, i+1)
+	case i >= 0:
+		pending[i] = p
+	case !p.done():
+		pending = append(pending, p)
+	}
+	return o.write(pending)
+}
+
+// Remove the entry of a release, without delivering it
+func (o *Outbox) Discard(id int) error {
+	return o.put(Pending{ReleaseId: id, Rated: true, Collected: true})
+}
+
+// Deliver whatever has not been delivered yet. Unless forced, a rating is not
+// PUT if the release already has a different rating; ErrConflict is returned
+// instead.
+func (c *Client) deliver(p *Pending, force bool) error {
+	// releases/{p.ReleaseId}/rating/{username}
+	urlpath, _ := url.JoinPath(
+		"releases",
+		strconv.Itoa(p.ReleaseId),
+		"rating",
+		c.Username,
+	)
+
+	if !p.Rated && !force {
+		current, err := c.GetRating(p.ReleaseId)
+		if err != nil {
+			return err
+		}
+		switch current {
+		case 0:
+		case p.Rating: // e.g. the response to an earlier PUT was lost
+			p.Rated = true
+		default:
+			p.Conflict = current
+			return ErrConflict
+		}
+	}
+
+	if !p.Rated {
+		resp, err := c.makeReq(
+			context.Background(),
+			urlpath,
+			"PUT",
+			map[string]any{
+				"username":   c.Username,
+				"release_id": p.ReleaseId,
+				"rating":     p.Rating,
+			},
+		)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		p.Rated = true
+		p.Conflict = 0
+	}
+
+	if !p.Collected {
+		postUrlPath, _ := url.JoinPath(
+			"users",
+			c.Username,
+			"collection/folders/1/releases",
+			strconv.Itoa(p.ReleaseId),
+		)
+		resp, err := c.makeReq(context.Background(), postUrlPath, "POST", nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		p.Collected = true
+	}
+	return nil
+}
+
+// Record a new rating. Without an outbox, the rating is delivered directly,
+// and any error is returned. With an outbox, an error is only returned if the
+// outbox could not be written; failed deliveries are left for Sync.
+//
+// If the existing rating was already checked, it is not checked again (which
+// would cost a request); otherwise, e.g. if Discogs was unreachable at the
+// time, conflicts are detected on delivery.
+func (c *Client) submit(p *Pending, checked bool) error {
+	if c.Outbox == nil {
+		return c.deliver(p, true)
+	}
+	if err := c.Outbox.put(*p); err != nil {
+		return err
+	}
+	if err := c.deliver(p, checked); err != nil {
+		p.Attempts++
+		p.Error = err.Error()
+		log.Println("rating queued:", p.ReleaseId, err)
+	}
+	return c.Outbox.put(*p)
+}
+
+type SyncResult struct {
+	Delivered []Pending
+	Conflicts []Pending // left in the outbox
+	Failed    []Pending // left in the outbox
+}
+
+// Deliver all pending ratings. Conflicting ratings are skipped (and reported)
+// unless forced, in which case they overwrite the rating on Discogs. Delivery
+// stops at the first error that would likely also affect the remaining
+// ratings (e.g. Discogs is unreachable); this error is returned.
+func Sync(force bool) (SyncResult, error) { return Default.Sync(force) }
+
+func (c *Client) Sync(force bool) (SyncResult, error) {
+	var res SyncResult
+	if c.Outbox == nil {
+		return res, nil
+	}
+	pending, err := c.Outbox.Pending()
+	if err != nil {
+		return res, err
+	}
+
+	for i, p := range pending {
+		if p.Conflict != 0 && !force {
+			res.Conflicts = append(res.Conflicts, p)
+			continue
+		}
+
+		err := c.deliver(&p, force)
+		switch {
+		case err == nil:
+			res.Delivered = append(res.Delivered, p)
+		case errors.Is(err, ErrConflict):
+			res.Conflicts = append(res.Conflicts, p)
+		default:
+			p.Attempts++
+			p.Error = err.Error()
+			res.Failed = append(res.Failed, p)
+		}
+		if err := c.Outbox.put(p); err != nil {
+			return res, err
+		}
+
+		if errors.Is(err, ErrNetwork) || errors.Is(err, ErrAuth) || errors.Is(err, ErrRateLimited) {
+			res.Failed = append(res.Failed, pending[i+1:]...)
+			return res, err
+		}
+	}
+	return res, nil
+}
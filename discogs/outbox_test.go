@@ -0,0 +1,121 @@
+package discogs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutbox(t *testing.T) {
+	ratings := make(map[string]int)   // path -> rating
+	collected := make(map[string]int) // path -> number of POSTs
+	var gets int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			gets++
+			_ = json.NewEncoder(w).Encode(map[string]int{"rating": ratings[r.URL.Path]})
+		case "PUT":
+			var body struct{ Rating int }
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			ratings[r.URL.Path] = body.Rating
+			w.WriteHeader(http.StatusCreated)
+		case "POST":
+			collected[r.URL.Path]++
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer s.Close()
+
+	c := NewClient("test", "")
+	c.BaseURL = s.URL
+	c.Outbox = NewOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+
+	// delivered immediately, without checking again
+	p := Pending{ReleaseId: 1, Rating: 4}
+	assert.Nil(t, c.submit(&p, true))
+	assert.True(t, p.done())
+	assert.Equal(t, gets, 0)
+	assert.Equal(t, ratings["/releases/1/rating/test"], 4)
+	pending, _ := c.Outbox.Pending()
+	assert.Empty(t, pending)
+
+	// queued while down
+	c.BaseURL = "http://127.0.0.1:1"
+	p = Pending{ReleaseId: 2, Rating: 3}
+	assert.Nil(t, c.submit(&p, true))
+	p = Pending{ReleaseId: 3, Rating: 5}
+	assert.Nil(t, c.submit(&p, true))
+	pending, _ = c.Outbox.Pending()
+	assert.Len(t, pending, 2)
+	assert.Equal(t, pending[0].Attempts, 1)
+
+	res, err := c.Sync(false)
+	assert.ErrorIs(t, err, ErrNetwork)
+	assert.Len(t, res.Failed, 2)
+	pending, _ = c.Outbox.Pending()
+	assert.Equal(t, pending[0].Attempts, 2)
+
+	// meanwhile, 3 was rated on the website
+	c.BaseURL = s.URL
+	ratings["/releases/3/rating/test"] = 2
+	res, err = c.Sync(false)
+	assert.Nil(t, err)
+	assert.Len(t, res.Delivered, 1)
+	assert.Len(t, res.Conflicts, 1)
+	assert.Equal(t, res.Conflicts[0].Conflict, 2)
+	assert.Equal(t, ratings["/releases/2/rating/test"], 3)
+	assert.Equal(t, collected["/users/test/collection/folders/1/releases/2"], 1)
+
+	// conflicts stay until forced (or discarded)
+	res, _ = c.Sync(false)
+	assert.Len(t, res.Conflicts, 1)
+	res, _ = c.Sync(true)
+	assert.Len(t, res.Delivered, 1)
+	assert.Equal(t, ratings["/releases/3/rating/test"], 5)
+	pending, _ = c.Outbox.Pending()
+	assert.Empty(t, pending)
+
+	// unchecked ratings (e.g. made offline) are checked on delivery
+	ratings["/releases/4/rating/test"] = 1
+	p = Pending{ReleaseId: 4, Rating: 5}
+	assert.Nil(t, c.submit(&p, false))
+	pending, _ = c.Outbox.Pending()
+	assert.Len(t, pending, 1)
+	assert.Equal(t, pending[0].Conflict, 1)
+	assert.Equal(t, ratings["/releases/4/rating/test"], 1)
+}
+
+func TestRateOffline(t *testing.T) {
+	c := NewClient("test", "")
+	c.BaseURL = "http://127.0.0.1:1"
+	c.Outbox = NewOutbox(filepath.Join(t.TempDir(), "outbox.json"))
+	var prompted *Release
+	c.Prompt = func(r *Release, _ []Action) (int, error) {
+		prompted = r
+		return 4, nil
+	}
+
+	// a master, e.g. from the mapping (or cache)
+	r := &Release{Id: 6440, Primary: 377464, Title: "Ride the Lightning"}
+	rating, err := c.Rate(r)
+	assert.Nil(t, err)
+	assert.Equal(t, rating, 4)
+	assert.Equal(t, prompted.Title, "Ride the Lightning")
+	assert.Equal(t, prompted.URL(), "https://www.discogs.com/release/377464")
+
+	pending, _ := c.Outbox.Pending()
+	assert.Len(t, pending, 1)
+	assert.Equal(t, pending[0].ReleaseId, 377464)
+	assert.Equal(t, pending[0].Rating, 4)
+	assert.False(t, pending[0].Rated)
+
+	// without an outbox, there is nothing to queue to
+	c.Outbox = nil
+	_, err = c.Rate(r)
+	assert.ErrorIs(t, err, ErrNetwork)
+}
@@ -0,0 +1,37 @@
+package discogs
+
+import "iter"
+
+// Returned by all paginated endpoints
+type Pagination struct {
+	Page    int
+	Pages   int
+	PerPage int `json:"per_page"`
+	Items   int
+}
+
+func (p Pagination) More() bool { return p.Page < p.Pages }
+
+// Yield the items of consecutive pages (starting from the first), fetching
+// each page only when needed. If a page cannot be fetched, its error is
+// yielded (with a zero item), and iteration stops.
+func paginate[T any](fetch func(page int) ([]T, Pagination, error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for page := 1; ; page++ {
+			items, pag, err := fetch(page)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if !pag.More() || len(items) == 0 {
+				return
+			}
+		}
+	}
+}
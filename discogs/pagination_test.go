@@ -0,0 +1,45 @@
+package discogs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagination(t *testing.T) {
+	var requested []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		requested = append(requested, page)
+		_, _ = fmt.Fprintf(w, `{
+			"pagination": {"page": %s, "pages": 3, "per_page": 1, "items": 3},
+			"releases": [{"id": %s, "title": "r%s", "role": "Main"}]
+		}`, page, page, page)
+	}))
+	defer s.Close()
+
+	c := NewClient("test", "")
+	c.BaseURL = s.URL
+	a := Artist{Id: 1}
+
+	// stopping early does not fetch later pages
+	for r, err := range c.IterReleases(a) {
+		assert.Nil(t, err)
+		assert.Equal(t, r.Title, "r1")
+		break
+	}
+	assert.Equal(t, requested, []string{"1"})
+
+	releases, err := c.Releases(a)
+	assert.Nil(t, err)
+	assert.Len(t, releases, 3)
+	assert.Equal(t, releases[2].Title, "r3")
+	assert.Equal(t, requested, []string{"1", "1", "2", "3"})
+
+	_, pag, err := c.ReleasesPage(a, 3)
+	assert.Nil(t, err)
+	assert.False(t, pag.More())
+}
@@ -0,0 +1,99 @@
+// TUI prompt for rating a single release
+
+package discogs
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type ratingPrompt struct {
+	release *Release
+	actions []Action
+
+	rating  int
+	err     error  // ErrNotRated, or an action's Err
+	invalid string // last key, if it was invalid
+
+	height int
+}
+
+func (rp *ratingPrompt) Init() tea.Cmd { return nil }
+
+func (rp *ratingPrompt) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		rp.height = msg.Height
+
+	case tea.KeyMsg:
+		key := msg.String()
+		switch key {
+		case "1", "2", "3", "4", "5":
+			rp.rating = int(key[0] - '0')
+			return rp, tea.Quit
+		case "s", "enter", "esc", "ctrl+c":
+			rp.err = ErrNotRated
+			return rp, tea.Quit
+		}
+		for _, a := range rp.actions {
+			if key == a.Key {
+				rp.err = a.Err
+				return rp, tea.Quit
+			}
+		}
+		rp.invalid = key
+	}
+	return rp, nil
+}
+
+func (rp *ratingPrompt) choices() string {
+	s := "rating (1-5), [s]kip"
+	for _, a := range rp.actions {
+		s += fmt.Sprintf(", [%s] %s", a.Key, a.Desc)
+	}
+	return s + ": "
+}
+
+func (rp *ratingPrompt) View() string {
+	r := rp.release
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d :: %s :: %s\n", r.Year, r.artistName(), r.Title)
+	for _, f := range r.Formats {
+		fmt.Fprintln(&b, f)
+	}
+	fmt.Fprintln(&b, r.URL())
+	fmt.Fprintln(&b)
+
+	for _, t := range r.tracks() {
+		fmt.Fprintf(&b, "%-4s %s", t.Position, t.Title)
+		if t.Duration != "" {
+			fmt.Fprintf(&b, " (%s)", t.Duration)
+		}
+		fmt.Fprintln(&b)
+	}
+
+	prompt := rp.choices()
+	if rp.invalid != "" {
+		prompt = fmt.Sprintf("invalid: %q\n", rp.invalid) + prompt
+	}
+
+	// the prompt must remain visible, even with long tracklists
+	details := lipgloss.NewStyle().MaxHeight(max(rp.height-3, 1)).Render(b.String())
+	return lipgloss.JoinVertical(lipgloss.Left, details, "", prompt)
+}
+
+// The default Prompter: a bubbletea program showing the release details and
+// tracklist. Invalid keys are ignored; ctrl+c skips.
+func PromptRating(r *Release, actions []Action) (int, error) {
+	rp := &ratingPrompt{release: r, actions: actions}
+	if _, err := tea.NewProgram(rp, tea.WithAltScreen()).Run(); err != nil {
+		return 0, err
+	}
+	if rp.err != nil {
+		return 0, rp.err
+	}
+	return rp.rating, nil
+}
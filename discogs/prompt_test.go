@@ -0,0 +1,52 @@
+package discogs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/exp/teatest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRatingPrompt(t *testing.T) {
+	r := &Release{
+		Id:      377464,
+		Title:   "Ride The Lightning",
+		Year:    1984,
+		Artists: []Artist{{Name: "Metallica"}},
+		Tracklist: []Track{
+			{Position: "A1", Type: "track", Title: "Fight Fire With Fire", Duration: "4:44"},
+		},
+	}
+
+	rp := &ratingPrompt{release: r, actions: []Action{WrongMatch}}
+	tm := teatest.NewTestModel(t, rp, teatest.WithInitialTermSize(80, 20))
+	teatest.WaitFor(t, tm.Output(), func(b []byte) bool {
+		return strings.Contains(string(b), "A1   Fight Fire With Fire (4:44)")
+	})
+
+	// invalid keys do not end the prompt
+	tm.Send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	teatest.WaitFor(t, tm.Output(), func(b []byte) bool {
+		return strings.Contains(string(b), `invalid: "x"`)
+	})
+	tm.Send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("4")})
+	tm.WaitFinished(t, teatest.WithFinalTimeout(time.Second))
+	assert.Equal(t, rp.rating, 4)
+	assert.Nil(t, rp.err)
+
+	rp = &ratingPrompt{release: r, actions: []Action{WrongMatch}}
+	tm = teatest.NewTestModel(t, rp)
+	tm.Send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("d")}) // not offered
+	tm.Send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("w")})
+	tm.WaitFinished(t, teatest.WithFinalTimeout(time.Second))
+	assert.ErrorIs(t, rp.err, ErrWrongMatch)
+
+	rp = &ratingPrompt{release: r}
+	tm = teatest.NewTestModel(t, rp)
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlC})
+	tm.WaitFinished(t, teatest.WithFinalTimeout(time.Second))
+	assert.ErrorIs(t, rp.err, ErrNotRated)
+}
@@ -0,0 +1,84 @@
+// Client-side rate limiting. Discogs allows a fixed number of requests per
+// minute (60 if authenticated), in a moving window; the limit and remaining
+// requests are reported in every response:
+//
+//	X-Discogs-Ratelimit: 60
+//	X-Discogs-Ratelimit-Used: 1
+//	X-Discogs-Ratelimit-Remaining: 59
+//
+// https://www.discogs.com/developers/#page:home,header:home-rate-limiting
+
+package discogs
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Token bucket, refilled continuously at limit tokens per minute. The bucket
+// size and the number of tokens are corrected with every response.
+type limiter struct {
+	mu     sync.Mutex
+	limit  float64 // per minute; also the size of the bucket
+	tokens float64
+	last   time.Time // of refill
+}
+
+func newLimiter(limit int) *limiter {
+	return &limiter{
+		limit:  float64(limit),
+		tokens: float64(limit),
+		last:   time.Now(),
+	}
+}
+
+func (l *limiter) refill(now time.Time) {
+	l.tokens = min(l.limit, l.tokens+now.Sub(l.last).Minutes()*l.limit)
+	l.last = now
+}
+
+// Block until a request can be made, or ctx is done
+func (l *limiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		l.refill(time.Now())
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / l.limit * float64(time.Minute))
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Adjust to the server's view of the limit. Missing headers are ignored.
+func (l *limiter) update(h http.Header) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	if limit, err := strconv.Atoi(h.Get("X-Discogs-Ratelimit")); err == nil && limit > 0 {
+		l.limit = float64(limit)
+	}
+	if rem, err := strconv.Atoi(h.Get("X-Discogs-Ratelimit-Remaining")); err == nil {
+		l.tokens = min(l.tokens, float64(rem))
+	}
+}
+
+// The server says we have made too many requests; wait for the bucket to fill
+// up again
+func (l *limiter) drain() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = 0
+	l.last = time.Now()
+}
@@ -0,0 +1,56 @@
+package discogs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(60)
+	assert.Nil(t, l.wait(context.Background()))
+
+	h := http.Header{}
+	h.Set("X-Discogs-Ratelimit", "60")
+	h.Set("X-Discogs-Ratelimit-Remaining", "0")
+	l.update(h)
+	assert.Less(t, l.tokens, 1.0)
+
+	// a token is refilled every second
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.wait(ctx), context.DeadlineExceeded)
+
+	start := time.Now()
+	assert.Nil(t, l.wait(context.Background()))
+	assert.Less(t, time.Since(start), 1500*time.Millisecond)
+
+	assert.True(t, retryable(http.StatusTooManyRequests))
+	assert.True(t, retryable(http.StatusBadGateway))
+	assert.False(t, retryable(http.StatusNotFound))
+}
+
+func TestRetry(t *testing.T) {
+	var n int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if n == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"rating": 3}`))
+	}))
+	defer s.Close()
+
+	c := NewClient("test", "")
+	c.BaseURL = s.URL
+	data, err := deserialize[struct{ Rating int }](c.makeReq(context.Background(), "/x", "GET", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, data.Rating, 3)
+	assert.Equal(t, n, 2)
+}
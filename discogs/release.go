@@ -1,13 +1,15 @@
 package discogs
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // A general-purpose struct that is shared across several contexts: search
@@ -30,13 +32,18 @@ type Release struct { // {{{
 	Artists     []Artist
 	ArtistsSort string `json:"artists_sort"`
 	ResourceUrl string `json:"resource_url"`
-	Year        int    // may be string (in search?)
+	Year        int    // string in search; see UnmarshalJSON
 
 	MasterId  int    `json:"master_id"`    // may be 0 (if no master)
 	MasterUrl string `json:"master_url"`   // may be empty (if no master)
 	Primary   int    `json:"main_release"` // master-only
 
-	// Formats []map[string]any // full release
+	// For full releases, all formats (e.g. CD + DVD). For artist releases
+	// and search results, a single format, parsed from a summary (e.g.
+	// "CD, Album"); this is usually absent for masters. See UnmarshalJSON.
+	Formats []Format
+
+	Tracklist []Track // full release and master
 
 	// search-only (?)
 
@@ -46,16 +53,214 @@ type Release struct { // {{{
 
 	// artist-only
 
-	Artist  string // artist-only
-	Label   string
-	Role    string                    // typically "Main"
-	Stats   map[string]map[string]int // 4 keys: "community"/"stats" -> "in_collection"/"in_wantlist"
-	Formats string                    // ", "-delimited, may be empty
+	Artist string // artist-only
+	Label  string
+	Role   string                    // typically "Main"
+	Stats  map[string]map[string]int // 4 keys: "community"/"stats" -> "in_collection"/"in_wantlist"
 } // }}}
 
+// An entry in a tracklist; may also be a heading (e.g. "CD1")
+type Track struct {
+	Position string
+	Type     string `json:"type_"` // "track", "heading" or "index"
+	Title    string
+	Duration string // m:ss, may be empty
+
+	SubTracks []Track `json:"sub_tracks"` // index only
+}
+
+// Excluding headings. Index tracks (i.e. groups of subtracks, such as the
+// movements of a symphony) are replaced by their subtracks, since these are
+// usually separate files.
+func (r *Release) tracks() []Track {
+	var tracks []Track
+	for _, t := range r.Tracklist {
+		switch {
+		case t.Type == "index" && len(t.SubTracks) > 0:
+			tracks = append(tracks, t.SubTracks...)
+		case t.Type == "track", t.Type == "index":
+			tracks = append(tracks, t)
+		}
+	}
+	return tracks
+}
+
+// Total duration of the tracklist; 0 if any track has no duration
+func (r *Release) duration() time.Duration {
+	var total time.Duration
+	for _, t := range r.tracks() {
+		d := parseDuration(t.Duration)
+		if d == 0 {
+			return 0
+		}
+		total += d
+	}
+	return total
+}
+
+// Parse [h:]m:ss; 0 if invalid
+func parseDuration(s string) time.Duration {
+	var d time.Duration
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		d = d*60 + time.Duration(n)
+	}
+	return d * time.Second
+}
+
+// A format of a full release, e.g. {"CD", 2, ["Album", "Compilation"], ""}
+type Format struct {
+	Name         string // e.g. "Vinyl", "CD", "Cass", "DVD"
+	Qty          int    `json:"qty,string"`
+	Descriptions []string
+	Text         string // free text, e.g. "Deluxe Edition"
+}
+
+func (f Format) String() string {
+	s := strings.Join(append([]string{f.Name}, f.Descriptions...), ", ")
+	if f.Qty > 1 {
+		s = strconv.Itoa(f.Qty) + "x" + s
+	}
+	return s
+}
+
+// Parse a format summary, which is either ", "-delimited (artist releases) or
+// a list (search results). The quantity, if any, is left in the name.
+func parseFormatSummary(b json.RawMessage) (Format, error) {
+	var parts []string
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		parts = strings.Split(s, ", ")
+	} else if err := json.Unmarshal(b, &parts); err != nil {
+		return Format{}, err
+	}
+	if len(parts) == 0 || parts[0] == "" {
+		return Format{}, nil
+	}
+	return Format{Name: parts[0], Descriptions: parts[1:]}, nil
+}
+
+// Year is a string in search results, and an int everywhere else. Likewise,
+// format is a string in artist releases, and a list in search results; full
+// releases have formats instead.
+func (r *Release) UnmarshalJSON(b []byte) error {
+	type release Release // without methods, to avoid recursion
+	aux := struct {
+		*release
+		Year   json.RawMessage
+		Format json.RawMessage
+	}{release: (*release)(r)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+
+	if len(aux.Format) > 0 && len(r.Formats) == 0 {
+		f, err := parseFormatSummary(aux.Format)
+		if err != nil {
+			return err
+		}
+		if f.Name != "" {
+			r.Formats = []Format{f}
+		}
+	}
+
+	if len(aux.Year) == 0 {
+		return nil
+	}
+	var year string
+	if json.Unmarshal(aux.Year, &year) == nil {
+		r.Year, _ = strconv.Atoi(year)
+		return nil
+	}
+	return json.Unmarshal(aux.Year, &r.Year)
+}
+
+// Full release, by id
+func GetRelease(id int) (Release, error) { return Default.GetRelease(id) }
+
+func GetMaster(id int) (Release, error) { return Default.GetMaster(id) }
+
+func (c *Client) GetRelease(id int) (Release, error) {
+	return deserialize[Release](
+		c.makeReq(context.Background(), "/releases/"+strconv.Itoa(id), "GET", nil),
+	)
+}
+
+func (c *Client) GetMaster(id int) (Release, error) {
+	return deserialize[Release](
+		c.makeReq(context.Background(), "/masters/"+strconv.Itoa(id), "GET", nil),
+	)
+}
+
+// First credited artist
+func (r *Release) artistName() string {
+	if len(r.Artists) > 0 {
+		return artistSuffix.ReplaceAllString(r.Artists[0].Name, "")
+	}
+	return r.ArtistsSort
+}
+
+func (r *Release) URL() string {
+	kind := "release"
+	if r.Primary > 0 {
+		kind = "master"
+	}
+	return fmt.Sprintf("https://www.discogs.com/%s/%d", kind, r.Id)
+}
+
 func (r *Release) inCollection() bool { return r.Stats["user"]["in_collection"] > 0 }
 
-func (r *Release) IsRateable() bool { return !r.inCollection() && r.Role == "Main" && !r.ignored() }
+// Role is only present in artist releases. Masters have no formats, so they
+// are only checked for ignored formats once the main release is fetched (in
+// Rate).
+func (r *Release) IsRateable() bool {
+	return !r.inCollection() && (r.Artist == "" || r.Role == "Main") && !r.ignored()
+}
+
+// Format names and descriptions that are not worth rating. Both the full
+// names (used in full releases) and abbreviations (used in artist releases)
+// must be listed. Can be overridden with ignored_formats in the config.
+var IgnoredFormats = map[string]any{
+	// maps are var-only
+
+	"Comp":        nil,
+	"Compilation": nil,
+	"DVD":         nil,
+	"DVD-V":       nil,
+	"DVD-Video":   nil,
+	"Shellac":     nil,
+	"Single":      nil,
+}
+
+func (f Format) ignored() bool {
+	if _, ig := IgnoredFormats[f.Name]; ig {
+		return true
+	}
+	for _, d := range f.Descriptions {
+		if _, ig := IgnoredFormats[d]; ig {
+			return true
+		}
+	}
+	return false
+}
+
+// A release is only ignored if all of its formats are; e.g. a CD album with a
+// bonus DVD is not. Releases without formats are never ignored.
+func (r *Release) ignored() bool {
+	for _, f := range r.Formats {
+		if !f.ignored() {
+			return false
+		}
+	}
+	if len(r.Formats) > 0 {
+		log.Println("ignored format:", r.Id, r.Title, r.Formats)
+		return true
+	}
+	return false
+}
 
 // TODO: private/namespace? these errors are only relevant for 1 function.
 // enums address this somewhat, but cannot be nil'd
@@ -64,110 +269,152 @@ var (
 	ErrNotRated     = errors.New("Release not rated")
 	ErrNotRateable  = errors.New("Release not eligible for rating")
 	ErrAlreadyRated = errors.New("Release already rated") // in Rust, would contain an inner value
-	ErrUnhandled    = errors.New("Failed to parse JSON (probably)")
 
 	// i would have preferred an enum, but an int cannot be nil'd, and
 	// leads to unclear intent
 	// https://old.reddit.com/r/golang/comments/fg6527/simple_error_enum/fk53no5/
 )
 
-func (r *Release) Rate() (int, error) { // {{{
+// Actions that may be offered alongside a rating (see Rate). If chosen, its
+// Err is returned by Rate.
+type Action struct {
+	Key  string
+	Desc string
+	Err  error
+}
+
+var (
+	ErrWrongMatch = errors.New("Wrong release")
+	ErrDelete     = errors.New("Delete requested")
+
+	WrongMatch = Action{"w", "wrong match, search again", ErrWrongMatch}
+	Delete     = Action{"d", "delete", ErrDelete}
+)
+
+// Ask the user for a rating of a (full) release. Returns the rating, or
+// ErrNotRated if skipped, or the Err of a chosen action.
+type Prompter func(r *Release, actions []Action) (int, error)
+
+// Prompt the user for a rating (unless already rated), and submit it. Aside
+// from skipping, the user may choose one of the given actions, in which case
+// its Err is returned.
+func (r *Release) Rate(actions ...Action) (int, error) { return Default.Rate(r, actions...) }
+
+func (c *Client) Rate(r *Release, actions ...Action) (int, error) {
+	full, checked, err := c.rateable(r)
+	if err != nil {
+		return 0, err
+	}
+	prompt := c.Prompt
+	if prompt == nil {
+		prompt = PromptRating
+	}
+	rating, err := prompt(full, actions)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.setRating(full, rating, checked); err != nil {
+		return 0, err
+	}
+	return rating, nil
+}
+
+// The full release of r (which may be a master or artist release), if it can
+// be rated, and has not been rated yet (ErrAlreadyRated).
+//
+// With an outbox, Discogs being unreachable is not an error: r itself stands
+// in for the full release, and whether it was already rated is left for
+// delivery (see deliver).
+func (c *Client) Rateable(r *Release) (*Release, error) {
+	full, _, err := c.rateable(r)
+	return full, err
+}
+
+// As Rateable; checked is false if Discogs was unreachable, and the existing
+// rating could not be checked
+func (c *Client) rateable(r *Release) (*Release, bool, error) { // {{{
 	if r.Id == 0 {
-		return 0, ErrNotFound
+		return nil, false, ErrNotFound
 	}
 
 	if !r.IsRateable() {
-		return 0, ErrNotRateable
+		return nil, false, ErrNotRateable
 	}
 
 	// TODO: leaky abstraction that should be handled at lower level
+	var id int
 	switch {
 	case r.Primary > 0: // master release
-		r = deserialize(
-			makeReq("/releases/"+strconv.Itoa(r.Primary), "GET", nil),
-			&Release{},
-		)
+		id = r.Primary
 	case r.Artist != "": // artist release
-		r = deserialize(
-			makeReq("/releases/"+strconv.Itoa(r.Id), "GET", nil),
-			&Release{},
-		)
+		id = r.Id
+	}
+	if id > 0 {
+		full, err := c.GetRelease(id)
+		switch {
+		case c.offline(err):
+			log.Println("offline, rating will be queued:", id, r.Title)
+			full = *r
+			full.Id = id
+			full.Primary = 0
+			return &full, false, nil
+		case err != nil:
+			return nil, false, err
+		}
+		r = &full
+		if r.ignored() {
+			return nil, false, ErrNotRateable
+		}
 	}
 
-	// releases/{r.Id}/rating/{username}
+	// an error here usually means incorrect was Id supplied (i.e. master
+	// id instead of release id)
+	rating, err := c.GetRating(r.Id)
+	switch {
+	case c.offline(err):
+		log.Println("offline, rating will be queued:", r.Id, r.Title)
+		return r, false, nil
+	case err != nil:
+		return nil, false, err
+	case rating != 0:
+		log.Println("already rated:", r.Id, r.Title, rating)
+		return nil, false, ErrAlreadyRated
+	}
+	return r, true, nil
+} // }}}
+
+// Ratings can only be queued with an outbox
+func (c *Client) offline(err error) bool { return c.Outbox != nil && errors.Is(err, ErrNetwork) }
+
+// The user's rating of a (full) release; 0 if not rated. Never cached.
+func GetRating(id int) (int, error) { return Default.GetRating(id) }
+
+func (c *Client) GetRating(id int) (int, error) {
+	// releases/{id}/rating/{username}
 	urlpath, _ := url.JoinPath(
 		"releases",
-		strconv.Itoa(r.Id),
+		strconv.Itoa(id),
 		"rating",
-		Config.Username,
+		c.Username,
 	)
-
-	resp := makeReq(urlpath, "GET", nil)
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		panic(err)
-	}
-	var currentRating map[string]any
-	// an error here usually means incorrect was Id supplied (i.e. master
-	// id instead of release id)
-	if err := json.Unmarshal(body, &currentRating); err != nil {
-		return 0, ErrUnhandled
-	}
-	if int(currentRating["rating"].(float64)) != 0 {
-		log.Println("already rated:", r.Id, r.Title, currentRating)
-		return 0, ErrAlreadyRated
-	}
-
-	fmt.Println(r.Year, "::", r.Artists[0].Name, "::", r.Title)
-	fmt.Printf("https://www.discogs.com/release/%d\n", r.Id)
-	fmt.Print("rating: ")
-	var input string
-
-	// can only exit with ctrl+\, not ctrl+c
-	// empty input is an error; ignore this
-	_, _ = fmt.Scanln(&input)
-
-	var newRating int
-	switch input {
-
-	case "1", "2", "3", "4", "5":
-		newRating, _ = strconv.Atoi(input)
-		makeReq(
-			urlpath,
-			"PUT",
-			map[string]any{
-				"username":   Config.Username,
-				"release_id": r.Id,
-				"rating":     newRating,
-			},
-		)
-
-	case "x":
-		// TODO: return some enum variant, to signal to caller to do
-		// something
-		panic("not impl")
-
-	case "":
-		return 0, ErrNotRated
-
-	default:
-		// TODO: should loop until input in [12345] or empty
-		log.Println("invalid rating:", input)
-		return 0, ErrNotRated
-
-	}
-
-	postUrlPath, err := url.JoinPath(
-		"users",
-		Config.Username,
-		"collection/folders/1/releases",
-		strconv.Itoa(r.Id),
+	data, err := deserialize[struct{ Rating int }](
+		c.makeReq(WithoutCache(context.Background()), urlpath, "GET", nil),
 	)
-	if err != nil {
-		panic(err)
-	}
+	return data.Rating, err
+}
 
-	makeReq(postUrlPath, "POST", nil)
-	return newRating, nil
-} // }}}
+// Rate a (full) release, and add it to the collection, without prompting. No
+// checks are made (see Rateable). With an outbox, failed deliveries are retried
+// by Sync, and are not an error.
+func SetRating(r *Release, rating int) error { return Default.SetRating(r, rating) }
+
+func (c *Client) SetRating(r *Release, rating int) error { return c.setRating(r, rating, true) }
+
+// If not checked, the existing rating is checked on delivery (see deliver)
+func (c *Client) setRating(r *Release, rating int, checked bool) error {
+	if rating < 1 || rating > 5 {
+		return fmt.Errorf("invalid rating: %d", rating)
+	}
+	p := Pending{ReleaseId: r.Id, Title: r.Title, Rating: rating, Time: time.Now()}
+	return c.submit(&p, checked)
+}
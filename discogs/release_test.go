@@ -0,0 +1,45 @@
+package discogs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormats(t *testing.T) {
+	parse := func(s string) Release {
+		var r Release
+		assert.Nil(t, json.Unmarshal([]byte(s), &r))
+		return r
+	}
+
+	full := parse(`{"formats": [
+		{"name": "CD", "qty": "2", "descriptions": ["Album", "Compilation"]},
+		{"name": "DVD", "qty": "1", "descriptions": ["DVD-Video"]}
+	]}`)
+	assert.Equal(t, full.Formats[0], Format{Name: "CD", Qty: 2, Descriptions: []string{"Album", "Compilation"}})
+	assert.Equal(t, full.Formats[0].String(), "2xCD, Album, Compilation")
+	assert.True(t, full.ignored())
+
+	artist := parse(`{"format": "Cass, Demo", "artist": "x", "role": "Main"}`)
+	assert.Equal(t, artist.Formats, []Format{{Name: "Cass", Descriptions: []string{"Demo"}}})
+	assert.False(t, artist.ignored())
+	assert.True(t, artist.IsRateable())
+
+	search := parse(`{"format": ["Vinyl", "7\"", "Single"], "year": "1984"}`)
+	assert.Equal(t, search.Year, 1984)
+	assert.True(t, search.ignored())
+	assert.False(t, search.IsRateable())
+
+	// bonus dvd does not make the album ignored
+	deluxe := parse(`{"formats": [
+		{"name": "CD", "qty": "1", "descriptions": ["Album"]},
+		{"name": "DVD", "qty": "1"}
+	]}`)
+	assert.False(t, deluxe.ignored())
+
+	master := parse(`{"main_release": 1}`)
+	assert.Nil(t, master.Formats)
+	assert.False(t, master.ignored())
+}
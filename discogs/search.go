@@ -1,30 +1,57 @@
 package discogs
 
 import (
+	"context"
+	"iter"
 	"log"
 	"strconv"
-	"time"
 )
 
 type SearchResult struct {
-	Pagination map[string]any
+	Pagination Pagination
 	Results    []Release
 }
 
-// Search for releases
-func Search(artist string, album string) SearchResult {
+// Search for releases. Only the first page of results is returned; see
+// IterSearch.
+func Search(artist string, album string) (SearchResult, error) {
+	return Default.Search(artist, album)
+}
+
+// All search results, fetched one page at a time as needed
+func IterSearch(artist string, album string) iter.Seq2[Release, error] {
+	return Default.IterSearch(artist, album)
+}
+
+func (c *Client) Search(artist string, album string) (SearchResult, error) {
+	return c.SearchPage(artist, album, 1)
+}
+
+func (c *Client) IterSearch(artist string, album string) iter.Seq2[Release, error] {
+	return paginate(func(page int) ([]Release, Pagination, error) {
+		res, err := c.SearchPage(artist, album, page)
+		return res.Results, res.Pagination, err
+	})
+}
+
+// A single page of search results (starting from 1)
+func (c *Client) SearchPage(artist string, album string, page int) (SearchResult, error) {
 	// returning SearchResult (instead of []Release) might look weird
 	// (compared to SearchArtist), but i want to be able to get primary via
 	// a method for clearer intent (i.e. `result.Primary()` instead of
 	// `getPrimary(releases)`)
 	log.Println("searching", artist, album)
-	resp := makeReq(
+	// compiler does -not- allow map[string]string, which is silly
+	query := map[string]any{"artist": alnum(artist), "release_title": alnum(album)}
+	if page > 1 {
+		query["page"] = strconv.Itoa(page)
+	}
+	return deserialize[SearchResult](c.makeReq(
+		context.Background(),
 		"/database/search",
 		"GET",
-		// compiler does -not- allow map[string]string, which is silly
-		map[string]any{"artist": alnum(artist), "release_title": alnum(album)},
-	)
-	return deserialize(resp, SearchResult{})
+		query,
+	))
 }
 
 // If r.Results contains a master release (correctness is not checked), returns
@@ -33,35 +60,40 @@ func Search(artist string, album string) SearchResult {
 //
 // Note: a GET call is always performed.
 //
-// If no results are found, returns empty Release (Id = 0); callers should
-// check Release.Id.
-func (r *SearchResult) Primary() Release {
+// If no results are found, returns ErrNotFound (and an empty Release).
+//
+// This does not check the result against anything; to find the release of a
+// local album, use Matches.
+func (r *SearchResult) Primary() (Release, error) { return Default.Primary(r) }
+
+func (c *Client) Primary(r *SearchResult) (Release, error) {
 	// TODO: return *Release? (can check nil = clearer intent)
 	if len(r.Results) == 0 {
-		return Release{}
+		return Release{}, ErrNotFound
 	}
 	for i, res := range r.Results {
-		if i > Config.MaxResults {
+		if i > c.MaxResults {
 			break
 		}
 
 		if res.MasterId == 0 {
-			time.Sleep(time.Second)
 			continue
 		}
 
-		m := deserialize(
-			// TODO: should use url.joinpath, but i'm lazy to handle errors
-			makeReq("/masters/"+strconv.Itoa(res.MasterId), "GET", nil),
-			Release{},
+		// TODO: should use url.joinpath, but i'm lazy to handle errors
+		m, err := deserialize[Release](
+			c.makeReq(context.Background(), "/masters/"+strconv.Itoa(res.MasterId), "GET", nil),
 		)
-		// log.Println("foo", m)
-		ensure(len(m.Artists) > 0)
-		return m
+		if err != nil {
+			return Release{}, err
+		}
+		if len(m.Artists) == 0 {
+			return Release{}, &RequestError{Kind: ErrDecode, Method: "GET", Path: "/masters/" + strconv.Itoa(res.MasterId)}
+		}
+		return m, nil
 
 	}
-	return deserialize(
-		makeReq("/releases/"+strconv.Itoa(r.Results[0].Id), "GET", nil),
-		Release{},
+	return deserialize[Release](
+		c.makeReq(context.Background(), "/releases/"+strconv.Itoa(r.Results[0].Id), "GET", nil),
 	)
 }
@@ -1,70 +1,83 @@
-package discogs
+package discogs_test
 
 import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"plaque/discogs"
+	"plaque/discogs/discogstest"
 )
 
 // note: tests are run in order of filename
 
-func TestSearch(t *testing.T) {
-	// r := discogsReq("/releases/14056043", "GET", nil)
-	// debugResponse(r)
-
-	// database/search?artist=++Tokyo+Jihen++&release_title=
-	// database/search?artist=++Tokyo+Jihen++&release_title=遭難
-
-	// r := discogsReq("/releases/9544961", "GET", nil)
-	// debugResponse(r)
-
-	// assert.Equal(t, discogsReq("", "GET", nil).StatusCode, 200)
-	assert.Equal(t, makeReq("/releases/4319735", "GET", nil).StatusCode, 200)
-
-	noResults := Search("Pyrrhic Salvation", "Demo")
-	assert.Equal(t, noResults.Primary().Id, 0) // TODO: Primary() should return nil
+// Responses are served from testdata; see discogstest
+func useFixtures(t *testing.T) {
+	d := discogs.Default
+	t.Cleanup(func() { discogs.Default = d })
+	discogs.Default = discogstest.NewClient(t, "testdata")
+}
 
-	rtl := Search("Metallica", "Ride the Lightning")
-	pri := rtl.Primary()
+func TestSearch(t *testing.T) {
+	useFixtures(t)
+
+	noResults, err := discogs.Search("Pyrrhic Salvation", "Demo")
+	assert.Nil(t, err)
+	_, err = noResults.Primary()
+	assert.ErrorIs(t, err, discogs.ErrNotFound)
+
+	rtl, err := discogs.Search("Metallica", "Ride the Lightning")
+	assert.Nil(t, err)
+	assert.Equal(t, rtl.Results[0].Year, 1984)
+	pri, err := rtl.Primary()
+	assert.Nil(t, err)
 	assert.Equal(t, pri.Id, 6440)
 	assert.Equal(t, pri.Primary, 377464)
 	assert.Equal(t, pri.Artists[0].Name, "Metallica")
 
 	// no master
-	kyw := Search("natsumen", "kill your winter")
-	assert.Equal(t, kyw.Primary().Id, 12578164)
+	kyw, err := discogs.Search("natsumen", "kill your winter")
+	assert.Nil(t, err)
+	pri, _ = kyw.Primary()
+	assert.Equal(t, pri.Id, 12578164)
+
+	// no fixture = 404
+	_, err = discogs.Search("foo", "bar")
+	assert.ErrorIs(t, err, discogs.ErrNotFound)
 }
 
 func TestSearchArtist(t *testing.T) {
-	pyr := SearchArtist("Pyrrhic Salvation")
-	assert.Len(t, pyr, 1)
+	useFixtures(t)
 
-	graal := SearchArtist("Graal")[0]
-	// assert.Equal(t, graal.UserData, nil)
-	assert.Len(t, graal.Releases(), 95)
+	met, err := discogs.SearchArtist("Metallica")
+	assert.Nil(t, err)
+	assert.Len(t, met, 2)
+	assert.Equal(t, met[0].Id, 18839)
+	assert.Equal(t, met[0].Title, "Metallica")
+	assert.True(t, met[0].UserData["in_collection"])
 
-	met := SearchArtist("Metallica")[0]
-	assert.Equal(t, met.Id, 18839)
+	releases, err := met[0].Releases()
+	assert.Nil(t, err)
+	assert.Len(t, releases, 3)
 
-	met1st := met.Releases()[0]
+	met1st := releases[0]
 	assert.Equal(t, met1st.Id, 7430321)
 	assert.Equal(t, met1st.Title, "Live Metal Up Your Ass / No Life 'Til Leather")
 	assert.Equal(t, met1st.Artist, "Metallica")
-	assert.Equal(t, met1st.Artists, []Artist(nil)) // no such field
-	// assert.Equal(t, met1st.Artists, []Artist{}) // field exists, but empty
+	assert.Equal(t, met1st.Artists, []discogs.Artist(nil)) // no such field
+	assert.Equal(t, met1st.ReleaseType, "release")
+	assert.True(t, met1st.IsRateable())
 
-	// artist releases
-	rv := SearchArtist("red velvet")[0].Releases()
-
-	assert.Equal(t, rv[0].Artist, "Red Velvet (3)")
-	assert.Equal(t, rv[0].ArtistsSort, "")
-	assert.Equal(t, rv[0].ReleaseType, "master")
-	assert.Equal(t, rv[5].Artist, "Red Velvet (3)")
-	assert.Equal(t, rv[5].ReleaseType, "release")
-	assert.Len(t, rv[0].Artists, 0)
-	assert.Len(t, rv[5].Artists, 0)
+	assert.Equal(t, releases[1].ReleaseType, "master")
+	assert.False(t, releases[1].IsRateable()) // in collection
+}
 
-	assert.Equal(t, SearchArtist("lil peep")[0].Releases()[0].Id, 11270776)
+func TestOffline(t *testing.T) {
+	d := discogs.Default
+	defer func() { discogs.Default = d }()
 
-	assert.Equal(t, SearchArtist("red velvet")[0].Title, "Red Velvet (3)")
+	discogs.Default = discogs.NewClient("test", "")
+	discogs.Default.BaseURL = "http://127.0.0.1:1" // nothing listens here
+	_, err := discogs.Search("Metallica", "Ride the Lightning")
+	assert.ErrorIs(t, err, discogs.ErrNetwork)
 }
@@ -3,8 +3,10 @@
 package discogs
 
 import (
+	"context"
+	"log"
 	"strconv"
-	"time"
+	"sync"
 
 	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
@@ -17,8 +19,13 @@ type discogsBrowser struct {
 	artists       []Artist
 	releases      map[int]*[]Release
 	releasesTable map[int]*table.Model
+	pages         map[int]Pagination // last page fetched
+	loading       map[int]bool       // next page is being fetched
 	cursor        int
 
+	// releases are fetched in the background
+	mu sync.Mutex
+
 	// releases map[*Artist]*[]Release
 	// // pointers are non-unique! (and structs can't even be used as keys)
 
@@ -28,15 +35,16 @@ type discogsBrowser struct {
 
 // additional heuristics/tui will usually be required to select the correct
 // artist; this is left to callers
-func SearchArtist(artist string) []Artist {
-	resp := makeReq(
+func SearchArtist(artist string) ([]Artist, error) { return Default.SearchArtist(artist) }
+
+func (c *Client) SearchArtist(artist string) ([]Artist, error) {
+	data, err := deserialize[struct{ Results []Artist }](c.makeReq(
+		context.Background(),
 		"/database/search",
 		"GET",
 		map[string]any{"q": alnum(artist), "type": "artist"},
-	)
-	return deserialize(resp, struct {
-		Results []Artist
-	}{}).Results
+	))
+	return data.Results, err
 }
 
 // Start a bubbletea program to browse artist discographies, and return
@@ -66,6 +74,8 @@ func BrowseArtists(artists []Artist) *Artist {
 		// make map necessary?
 		releases:      make(map[int]*[]Release, len(artists)),
 		releasesTable: make(map[int]*table.Model, len(artists)),
+		pages:         make(map[int]Pagination, len(artists)),
+		loading:       make(map[int]bool, len(artists)),
 	}
 
 	m, err := tea.NewProgram(&eb, tea.WithAltScreen()).Run()
@@ -90,24 +100,20 @@ func (db *discogsBrowser) getReleases(n int) {
 			continue
 		}
 		artist := db.artists[idx]
+		db.mu.Lock()
 		releases := db.releases[artist.Id]
+		db.mu.Unlock()
 		if releases == nil {
-			r := artist.Releases()
-			db.releases[artist.Id] = &r
-
-			time.Sleep(time.Second)
-
-			var rows []table.Row
-
-			for _, rel := range r {
-				row := table.Row{strconv.Itoa(rel.Year), rel.Title}
-				rows = append(rows, row)
+			// requests are rate limited, so no need to sleep here
+			r, pag, err := Default.ReleasesPage(artist, 1)
+			if err != nil {
+				// leave unpopulated, so that it is retried later
+				log.Println("could not get releases:", artist.Title, err)
+				continue
 			}
 
-			// log.Println("rows:", rows)
-
 			t := table.New(
-				table.WithRows(rows),
+				table.WithRows(releaseRows(r)),
 				table.WithColumns(
 					[]table.Column{
 						{Title: "Year", Width: 4},
@@ -116,13 +122,51 @@ func (db *discogsBrowser) getReleases(n int) {
 				),
 			)
 			// log.Println("table:", t)
-			db.releasesTable[artist.Id] = &t
 
+			db.mu.Lock()
+			db.releases[artist.Id] = &r
+			db.releasesTable[artist.Id] = &t
+			db.pages[artist.Id] = pag
+			db.mu.Unlock()
 		}
 
 	}
 }
 
+func releaseRows(releases []Release) []table.Row {
+	var rows []table.Row
+	for _, rel := range releases {
+		rows = append(rows, table.Row{strconv.Itoa(rel.Year), rel.Title})
+	}
+	return rows
+}
+
+// Sent when the next page of an artist's releases has been fetched
+type pageMsg struct {
+	id       int // artist
+	releases []Release
+	pag      Pagination
+	err      error
+}
+
+// If the table of the selected artist is scrolled near its end, fetch the
+// next page of releases (if any)
+func (db *discogsBrowser) loadMore() tea.Cmd {
+	artist := db.artists[db.cursor]
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t := db.releasesTable[artist.Id]
+	pag := db.pages[artist.Id]
+	if t == nil || db.loading[artist.Id] || !pag.More() || t.Cursor() < len(t.Rows())-t.Height() {
+		return nil
+	}
+	db.loading[artist.Id] = true
+	return func() tea.Msg {
+		r, pag, err := Default.ReleasesPage(artist, pag.Page+1)
+		return pageMsg{id: artist.Id, releases: r, pag: pag, err: err}
+	}
+}
+
 // Init is the first function that will be called. It returns an optional
 // initial command. To not perform an initial command return nil.
 func (db *discogsBrowser) Init() tea.Cmd {
@@ -138,6 +182,19 @@ func (db *discogsBrowser) Init() tea.Cmd {
 func (db *discogsBrowser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 
+	case pageMsg:
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		db.loading[msg.id] = false
+		if msg.err != nil {
+			log.Println("could not get more releases:", msg.err)
+			return db, nil
+		}
+		r := append(*db.releases[msg.id], msg.releases...)
+		db.releases[msg.id] = &r
+		db.releasesTable[msg.id].SetRows(releaseRows(r))
+		db.pages[msg.id] = msg.pag
+
 	case tea.WindowSizeMsg:
 		db.width = msg.Width
 		db.height = msg.Height
@@ -166,6 +223,17 @@ func (db *discogsBrowser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			go db.getReleases(2)
 
+		case "down", "up": // scroll releases of selected artist
+			db.mu.Lock()
+			t := db.releasesTable[db.artists[db.cursor].Id]
+			if t != nil && msg.String() == "down" {
+				t.MoveDown(1)
+			} else if t != nil {
+				t.MoveUp(1)
+			}
+			db.mu.Unlock()
+			return db, db.loadMore()
+
 		}
 	}
 	return db, nil
@@ -198,12 +266,18 @@ func (db *discogsBrowser) View() string {
 	if len(db.artists) == 0 {
 		return "no artists"
 	}
-	t := db.releasesTable[db.artists[db.cursor].Id]
-	if t == nil {
+	db.mu.Lock()
+	id := db.artists[db.cursor].Id
+	t := db.releasesTable[id]
+	switch {
+	case t == nil:
 		right = "wait..."
-	} else {
+	case db.loading[id]:
+		right = t.View() + "\nloading..."
+	default:
 		right = t.View()
 	}
+	db.mu.Unlock()
 
 	return lipgloss.JoinHorizontal(
 		lipgloss.Top,
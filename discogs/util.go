@@ -2,9 +2,13 @@ package discogs
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 	"unicode"
 
 	"golang.org/x/text/transform"
@@ -27,15 +31,30 @@ func ensure(c bool) {
 }
 
 // hacky function that uses generics (v1.18) to deserialize a http.Response
-// into an arbitrary target type T, without any error handling whatsoever
-func deserialize[T any](resp *http.Response, _ T) (data T) {
+// into an arbitrary target type T. Takes the return values of makeReq
+// directly, i.e. deserialize[T](makeReq(...))
+func deserialize[T any](resp *http.Response, err error) (data T, _ error) {
+	if err != nil {
+		return data, err
+	}
 	defer resp.Body.Close()
+	fail := func(kind error, err error) (T, error) {
+		return data, &RequestError{
+			Kind:   kind,
+			Method: resp.Request.Method,
+			Path:   resp.Request.URL.Path,
+			Status: resp.StatusCode,
+			Err:    err,
+		}
+	}
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		panic(err)
+		return fail(ErrNetwork, err)
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return fail(ErrDecode, err)
 	}
-	_ = json.Unmarshal(body, &data) // errors are ignored!
-	return data
+	return data, nil
 }
 
 func alnum(s string) string {
@@ -107,3 +126,61 @@ func surround(middle int, limit int, width int) (ints []int) {
 	// TODO: constrain ends to start,end of eb.artists (i wish go had Option)
 	return ints
 }
+
+// Lowercase, with punctuation and redundant whitespace removed. Strings that
+// are entirely non-ascii (which alnum would erase) are only lowercased.
+func normalise(s string) string {
+	n := strings.Join(strings.Fields(alnum(s)), " ")
+	if n == "" {
+		return strings.ToLower(strings.TrimSpace(s))
+	}
+	return strings.ToLower(n)
+}
+
+// Edit distance between a and b, in runes
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// 1 if a and b are equal (after normalisation), 0 if they have nothing in
+// common
+func similarity(a string, b string) float64 {
+	a, b = normalise(a), normalise(b)
+	n := max(len([]rune(a)), len([]rune(b)))
+	if n == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(a, b))/float64(n)
+}
+
+var urlPattern = regexp.MustCompile(`(?:^|/)(artist|master|release)s?/(\d+)`)
+
+// Parse a Discogs web (or api) url, e.g.
+// https://www.discogs.com/master/6440-Metallica-Ride-The-Lightning, into its
+// kind ("artist", "master" or "release") and id. The scheme and host may be
+// omitted, i.e. "master/6440" is also valid.
+func ParseURL(s string) (string, int, error) {
+	m := urlPattern.FindStringSubmatch(s)
+	if m == nil {
+		return "", 0, fmt.Errorf("not a discogs url: %s", s)
+	}
+	id, err := strconv.Atoi(m[2])
+	return m[1], id, err
+}
@@ -25,6 +25,29 @@ func TestUtil(t *testing.T) {
 		"Neworldisorder             ",
 	)
 
+	assert.Equal(t, levenshtein("kitten", "sitting"), 3)
+	assert.Equal(t, levenshtein("", "abc"), 3)
+	assert.Equal(t, levenshtein("夏面", "夏"), 1)
+	assert.Equal(t, similarity("Ride the Lightning", "Ride The Lightning!"), 1.0)
+	assert.Equal(t, similarity("", ""), 0.0)
+	assert.Less(t, similarity("Kill 'Em All", "Ride The Lightning"), 0.5)
+
+	for s, want := range map[string]struct {
+		kind string
+		id   int
+	}{
+		"https://www.discogs.com/master/6440-Metallica-Ride-The-Lightning": {"master", 6440},
+		"https://api.discogs.com/releases/377464":                          {"release", 377464},
+		"artist/18839": {"artist", 18839},
+	} {
+		kind, id, err := ParseURL(s)
+		assert.Nil(t, err)
+		assert.Equal(t, kind, want.kind)
+		assert.Equal(t, id, want.id)
+	}
+	_, _, err := ParseURL("6440")
+	assert.NotNil(t, err)
+
 	assert.Equal(t, surround(0, 5, 2), []int{0, 1, 5, 2, 4})
 	assert.Equal(t, surround(0, 6, 2), []int{0, 1, 6, 2, 5})
 	assert.Equal(t, surround(1, 6, 2), []int{1, 2, 0, 3, 6})
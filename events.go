@@ -0,0 +1,104 @@
+// Structured event stream for external scripts (scrobblers, notifiers, etc).
+// Each event is written as a single line of JSON to the configured sink:
+//
+//	file:/path/to/events.jsonl (append-only; "file:" may be omitted)
+//	fifo:/path/to/fifo         (events are dropped if there is no reader)
+//	unix:/path/to/socket       (stream socket; one connection per event)
+//
+// Delivery is best-effort; failure to emit an event never affects playback.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	PlayStart = "play-start"
+	PlayEnd   = "play-end" // Outcome: finished, resume
+	Rated     = "rated"
+	Enqueued  = "enqueued"
+	Dequeued  = "dequeued"
+	Deleted   = "deleted"
+)
+
+type event struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	hookVars
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// Parse sink into kind and path
+func parseSink(sink string) (string, string) {
+	kind, path, ok := strings.Cut(sink, ":")
+	if !ok {
+		return "file", os.ExpandEnv(sink)
+	}
+	return kind, os.ExpandEnv(path)
+}
+
+func writeSink(sink string, line []byte) error {
+	kind, path := parseSink(sink)
+	switch kind {
+	case "file":
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.Write(line)
+		return err
+
+	case "fifo":
+		// without O_NONBLOCK, open blocks until a reader appears
+		f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if errors.Is(err, syscall.ENXIO) { // no reader
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.Write(line)
+		return err
+
+	case "unix":
+		conn, err := net.DialTimeout("unix", path, time.Second)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+		_, err = conn.Write(line)
+		return err
+
+	default:
+		return errors.New("invalid sink: " + sink)
+	}
+}
+
+func emit(kind string, vars hookVars, outcome string) {
+	if config.Events.Sink == "" {
+		return
+	}
+	b, err := json.Marshal(event{
+		Time:     time.Now(),
+		Event:    kind,
+		hookVars: vars,
+		Outcome:  outcome,
+	})
+	if err != nil {
+		panic(err)
+	}
+	if err := writeSink(config.Events.Sink, append(b, '\n')); err != nil {
+		log.Println("could not emit event:", kind, err)
+	}
+}
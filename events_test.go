@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents(t *testing.T) {
+	events := config.Events
+	defer func() { config.Events = events }()
+
+	dir := t.TempDir()
+
+	// file
+	config.Events.Sink = filepath.Join(dir, "events.jsonl")
+	emit(PlayEnd, hookVars{Artist: "a", Album: "b"}, "finished")
+	emit(Rated, hookVars{Artist: "a", Album: "b", Rating: 4}, "")
+	f, _ := os.Open(config.Events.Sink)
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	var got []map[string]any
+	for sc.Scan() {
+		var e map[string]any
+		assert.Nil(t, json.Unmarshal(sc.Bytes(), &e))
+		delete(e, "time")
+		got = append(got, e)
+	}
+	assert.Equal(t, got, []map[string]any{
+		{"event": "play-end", "artist": "a", "album": "b", "outcome": "finished"},
+		{"event": "rated", "artist": "a", "album": "b", "rating": 4.0},
+	})
+
+	// unix socket
+	sock := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", sock)
+	assert.Nil(t, err)
+	defer l.Close()
+	lines := make(chan string)
+	go func() {
+		conn, _ := l.Accept()
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		lines <- line
+	}()
+	config.Events.Sink = "unix:" + sock
+	emit(Enqueued, hookVars{Path: "/x"}, "")
+	assert.Contains(t, <-lines, `"event":"enqueued","path":"/x"}`)
+
+	// fifo without reader must not block
+	fifo := filepath.Join(dir, "fifo")
+	assert.Nil(t, syscall.Mkfifo(fifo, 0644))
+	assert.Nil(t, writeSink("fifo:"+fifo, []byte("{}\n")))
+}
@@ -0,0 +1,236 @@
+// Playback history. Every playback of an album is appended to a jsonl file in
+// the state dir. History can be exported offline in common scrobble formats;
+// uploading is left to other tools.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type historyEntry struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Relpath string    `json:"relpath"`
+	Track   int       `json:"track,omitempty"` // index of the first track played
+	Outcome string    `json:"outcome"`         // see PlayEnd
+}
+
+func historyPath() string { return statePath("history.jsonl") }
+
+func recordHistory(relpath string, track int, start time.Time, outcome string) {
+	b, _ := json.Marshal(historyEntry{
+		Start:   start,
+		End:     time.Now(),
+		Relpath: relpath,
+		Track:   track,
+		Outcome: outcome,
+	})
+	f, err := os.OpenFile(historyPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println("could not record history:", err)
+		return
+	}
+	defer f.Close()
+	_, _ = f.Write(append(b, '\n'))
+}
+
+func readHistory() ([]historyEntry, error) {
+	f, err := os.Open(historyPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e historyEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			log.Println("invalid history entry:", sc.Text())
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+type listen struct {
+	At       time.Time
+	Duration time.Duration
+	trackTags
+}
+
+// Expand an album playback to per-track listens, assuming the tracks were
+// played in order, from e.Track onwards, starting at e.Start. Following the
+// usual scrobbling rules, a track only counts if it is longer than 30 s, and at
+// least half of it (or 4 min) was played before e.End. Tracks of unknown
+// duration are skipped.
+func (e historyEntry) listens() ([]listen, error) {
+	tracks, err := albumTracks(filepath.Join(config.Library.Root, e.Relpath))
+	if err != nil {
+		return nil, err
+	}
+
+	var listens []listen
+	at := e.Start
+	for i, t := range tracks {
+		if i < e.Track {
+			continue
+		}
+		d, err := trackDuration(t)
+		if err != nil || d == 0 {
+			continue
+		}
+		if at.Add(min(d/2, 4*time.Minute)).After(e.End) {
+			break
+		}
+		if d > 30*time.Second {
+			tags := readTags(t)
+			if tags.Track == 0 {
+				tags.Track = i + 1
+			}
+			listens = append(listens, listen{At: at, Duration: d, trackTags: tags})
+		}
+		at = at.Add(d)
+	}
+	return listens, nil
+}
+
+// https://listenbrainz.readthedocs.io/en/latest/users/json.html
+func exportListenBrainz(w io.Writer, listens []listen) error {
+	type payload struct {
+		ListenedAt    int64 `json:"listened_at"`
+		TrackMetadata struct {
+			ArtistName     string         `json:"artist_name"`
+			TrackName      string         `json:"track_name"`
+			ReleaseName    string         `json:"release_name,omitempty"`
+			AdditionalInfo map[string]any `json:"additional_info"`
+		} `json:"track_metadata"`
+	}
+
+	var ps []payload
+	for _, l := range listens {
+		var p payload
+		p.ListenedAt = l.At.Unix()
+		p.TrackMetadata.ArtistName = l.Artist
+		p.TrackMetadata.TrackName = l.Title
+		p.TrackMetadata.ReleaseName = l.Album
+		p.TrackMetadata.AdditionalInfo = map[string]any{
+			"duration_ms":       l.Duration.Milliseconds(),
+			"tracknumber":       l.Track,
+			"submission_client": "plaque",
+		}
+		if l.Mbid != "" {
+			p.TrackMetadata.AdditionalInfo["recording_mbid"] = l.Mbid
+		}
+		ps = append(ps, p)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{
+		"listen_type": "import",
+		"payload":     ps,
+	})
+}
+
+// https://web.archive.org/web/20170107015006/http://www.audioscrobbler.net/wiki/Portable_Player_Logging
+func exportScrobblerLog(w io.Writer, listens []listen) error {
+	clean := func(s string) string { return strings.ReplaceAll(s, "\t", " ") }
+
+	if _, err := fmt.Fprint(w, "#AUDIOSCROBBLER/1.1\n#TZ/UTC\n#CLIENT/plaque\n"); err != nil {
+		return err
+	}
+	for _, l := range listens {
+		_, err := fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%d\t%d\tL\t%d\t%s\n",
+			clean(l.Artist),
+			clean(l.Album),
+			clean(l.Title),
+			l.Track,
+			int(l.Duration.Seconds()),
+			l.At.Unix(),
+			l.Mbid,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plaque history export [-format listenbrainz|scrobbler] [-o file] [-since YYYY-MM-DD]
+func historyCommand(args []string) error {
+	if len(args) == 0 || args[0] != "export" {
+		return errors.New("usage: plaque history export [flags]")
+	}
+
+	fset := flag.NewFlagSet("history export", flag.ContinueOnError)
+	format := fset.String("format", "listenbrainz", "listenbrainz or scrobbler")
+	out := fset.String("o", "", "output file (default: stdout)")
+	since := fset.String("since", "", "only export listens after this date (YYYY-MM-DD)")
+	if err := fset.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var after time.Time
+	if *since != "" {
+		t, err := time.ParseInLocation(time.DateOnly, *since, time.Local)
+		if err != nil {
+			return err
+		}
+		after = t
+	}
+
+	export := map[string]func(io.Writer, []listen) error{
+		"listenbrainz": exportListenBrainz,
+		"scrobbler":    exportScrobblerLog,
+	}[*format]
+	if export == nil {
+		return fmt.Errorf("invalid format: %s", *format)
+	}
+
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+	var listens []listen
+	for _, e := range entries {
+		if e.Start.Before(after) {
+			continue
+		}
+		ls, err := e.listens()
+		if err != nil {
+			log.Println("skipping:", e.Relpath, err)
+			continue
+		}
+		listens = append(listens, ls...)
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return export(w, listens)
+}
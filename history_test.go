@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryExport(t *testing.T) {
+	root, state := config.Library.Root, config.StateDir
+	defer func() { config.Library.Root, config.StateDir = root, state }()
+	config.Library.Root = t.TempDir()
+	config.StateDir = t.TempDir()
+
+	album := filepath.Join(config.Library.Root, "Foo", "Bar (2000)")
+	_ = os.MkdirAll(album, 0755)
+	for name, b := range map[string][]byte{
+		"01 Intro.flac": makeFlac(20 * time.Second), // too short
+		"02 Baz.flac":   makeFlac(3*time.Minute, "TITLE=Baz", "ARTIST=The Foo"),
+		"03 Qux.flac":   makeFlac(10 * time.Minute),
+		"04 Quux.flac":  makeFlac(3 * time.Minute),
+	} {
+		_ = os.WriteFile(filepath.Join(album, name), b, 0644)
+	}
+
+	start := time.Unix(1700000000, 0)
+	entries := []historyEntry{
+		{Start: start, End: start.Add(time.Hour), Relpath: "Foo/Bar (2000)", Outcome: "finished"},
+		// quit after 5 minutes of track 3
+		{Start: start, End: start.Add(8*time.Minute + 20*time.Second), Relpath: "Foo/Bar (2000)", Outcome: "resume"},
+	}
+
+	ls, err := entries[0].listens()
+	assert.Nil(t, err)
+	assert.Len(t, ls, 3)
+
+	ls, err = entries[1].listens()
+	assert.Nil(t, err)
+	assert.Len(t, ls, 2)
+
+	var buf bytes.Buffer
+	assert.Nil(t, exportScrobblerLog(&buf, ls))
+	assert.Equal(t, strings.Split(buf.String(), "\n"), []string{
+		"#AUDIOSCROBBLER/1.1",
+		"#TZ/UTC",
+		"#CLIENT/plaque",
+		"The Foo\tBar\tBaz\t2\t180\tL\t1700000020\t",
+		"Foo\tBar\tQux\t3\t600\tL\t1700000200\t",
+		"",
+	})
+
+	buf.Reset()
+	assert.Nil(t, exportListenBrainz(&buf, ls[:1]))
+	assert.Contains(t, buf.String(), `"listened_at": 1700000020`)
+	assert.Contains(t, buf.String(), `"artist_name": "The Foo"`)
+
+	// started at track 3 (e.g. from focus mode)
+	e := historyEntry{Start: start, End: start.Add(11 * time.Minute), Relpath: "Foo/Bar (2000)", Track: 2}
+	ls, err = e.listens()
+	assert.Nil(t, err)
+	assert.Len(t, ls, 1)
+	assert.Equal(t, ls[0].Title, "Qux")
+	assert.Equal(t, ls[0].At, start)
+
+	recordHistory("Foo/Bar (2000)", 2, start, "finished")
+	h, err := readHistory()
+	assert.Nil(t, err)
+	assert.Len(t, h, 1)
+	assert.Equal(t, h[0].Outcome, "finished")
+	assert.Equal(t, h[0].Track, 2)
+}
@@ -0,0 +1,257 @@
+// Lifecycle hooks: arbitrary commands that are run on certain events. Each
+// hook is a shell-quoted command (no shell is actually invoked), and every
+// word is a text/template with access to hookVars. Template actions are never
+// split, and are only expanded after splitting, so values need no quoting
+// (e.g. `beet ls {{ .Artist }}` passes the artist as a single arg). The same
+// values are also passed as env vars (PLAQUE_ARTIST, etc).
+//
+//	[hooks.before-play]
+//	cmd = "notify-send 'now playing' '{{.Artist}} - {{.Album}}'"
+//	timeout = "5s"
+//	on_failure = "warn"
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	BeforePlay    = "before-play" // blocking cancels playback
+	AfterPlay     = "after-play"  // blocking skips post-playback actions
+	OnResumeQuit  = "on-resume-quit"
+	OnRate        = "on-rate" // blocking stops further rating
+	OnQueueChange = "on-queue-change"
+	OnDelete      = "on-delete" // run before deletion; blocking cancels it
+)
+
+const defaultHookTimeout = 30 * time.Second
+
+type hook struct {
+	Cmd     string
+	Timeout time.Duration
+	// block, warn (default), ignore. only block propagates the error to
+	// the caller
+	OnFailure string `mapstructure:"on_failure"`
+}
+
+// Also used for events, hence the json tags
+type hookVars struct {
+	Artist string `json:"artist,omitempty"`
+	Album  string `json:"album,omitempty"`
+	Path   string `json:"path,omitempty"`   // fullpath
+	Rating int    `json:"rating,omitempty"` // 0 if not applicable
+}
+
+func newHookVars(relpath string) hookVars {
+	artist, album := filepath.Split(relpath)
+	return hookVars{
+		Artist: strings.TrimSuffix(artist, "/"),
+		Album:  album,
+		Path:   filepath.Join(config.Library.Root, relpath),
+	}
+}
+
+func (v hookVars) env() map[string]string {
+	return map[string]string{
+		"PLAQUE_ARTIST": v.Artist,
+		"PLAQUE_ALBUM":  v.Album,
+		"PLAQUE_PATH":   v.Path,
+		"PLAQUE_RATING": strconv.Itoa(v.Rating),
+	}
+}
+
+var (
+	errUnterminatedQuote  = errors.New("unterminated quote")
+	errUnterminatedAction = errors.New("unterminated template action")
+)
+
+// Split s into words, following (a subset of) POSIX shell quoting rules:
+// single quotes, double quotes, backslash escapes, and $VAR/${VAR} expansion
+// (except within single quotes). Template actions ({{ ... }}) are copied
+// verbatim, and never split.
+func shellSplit(s string, lookup func(string) string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune // 0, '\'' or '"'
+
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+
+		case c == '\\' && i+1 < len(rs) &&
+			(quote == 0 || strings.ContainsRune(`"\$`, rs[i+1])):
+			i++
+			cur.WriteRune(rs[i])
+			inWord = true
+
+		case c == '{' && i+1 < len(rs) && rs[i+1] == '{':
+			end := strings.Index(string(rs[i:]), "}}")
+			if end < 0 {
+				return nil, errUnterminatedAction
+			}
+			action := []rune(string(rs[i:])[:end+2])
+			cur.WriteString(string(action))
+			i += len(action) - 1
+			inWord = true
+
+		case c == '$' && i+1 < len(rs):
+			var name string
+			if rs[i+1] == '{' {
+				end := strings.IndexRune(string(rs[i+2:]), '}')
+				if end < 0 {
+					return nil, errUnterminatedQuote
+				}
+				name = string(rs[i+2 : i+2+end])
+				i += 2 + end
+			} else {
+				j := i + 1
+				for j < len(rs) && (rs[j] == '_' ||
+					'a' <= rs[j] && rs[j] <= 'z' ||
+					'A' <= rs[j] && rs[j] <= 'Z' ||
+					'0' <= rs[j] && rs[j] <= '9') {
+					j++
+				}
+				if j == i+1 { // lone $
+					cur.WriteRune(c)
+					inWord = true
+					continue
+				}
+				name = string(rs[i+1 : j])
+				i = j - 1
+			}
+			cur.WriteString(lookup(name))
+			inWord = true
+
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+
+		default:
+			cur.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errUnterminatedQuote
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+func (h hook) args(vars hookVars) ([]string, error) {
+	env := vars.env()
+	words, err := shellSplit(h.Cmd, func(name string) string {
+		if v, ok := env[name]; ok {
+			return v
+		}
+		return os.Getenv(name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	for i, w := range words {
+		t, err := template.New("").Parse(w)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, vars); err != nil {
+			return nil, err
+		}
+		words[i] = buf.String()
+	}
+	return words, nil
+}
+
+func (h hook) run(vars hookVars) error {
+	args, err := h.args(vars)
+	if err != nil {
+		return err
+	}
+
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = os.Environ()
+	for k, v := range vars.env() {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// Run the hook configured for event, if any. An error is only returned if the
+// hook failed and its failure policy is "block".
+func runHook(event string, vars hookVars) error {
+	h, ok := config.Hooks[event]
+	if !ok || h.Cmd == "" {
+		return nil
+	}
+
+	log.Println("hook:", event, h.Cmd)
+	err := h.run(vars)
+	if err == nil {
+		return nil
+	}
+
+	switch h.OnFailure {
+	case "block":
+		log.Println("hook failed (blocking):", event, err)
+		return fmt.Errorf("%s hook: %w", event, err)
+	case "ignore":
+	default:
+		log.Println("hook failed:", event, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellSplit(t *testing.T) {
+	lookup := func(s string) string { return map[string]string{"X": "a b"}[s] }
+	for _, x := range []struct {
+		in  string
+		out []string
+	}{
+		{in: `a b  c`, out: []string{"a", "b", "c"}},
+		{in: `'a b' "c d"`, out: []string{"a b", "c d"}},
+		{in: `a\ b 'it''s'`, out: []string{"a b", "its"}},
+		{in: `"$X" $X '$X' ${X}y`, out: []string{"a b", "a b", "$X", "a by"}},
+		{in: `"a \"b\"" ''`, out: []string{`a "b"`, ""}},
+		{in: `x {{ .Artist }} "{{ $a := 1 }}$X"`, out: []string{"x", "{{ .Artist }}", "{{ $a := 1 }}a b"}},
+	} {
+		words, err := shellSplit(x.in, lookup)
+		assert.Nil(t, err, x.in)
+		assert.Equal(t, words, x.out, x.in)
+	}
+
+	_, err := shellSplit(`'a`, lookup)
+	assert.Equal(t, err, errUnterminatedQuote)
+	_, err = shellSplit(`a {{ .Artist`, lookup)
+	assert.Equal(t, err, errUnterminatedAction)
+}
+
+func TestHooks(t *testing.T) {
+	hooks := config.Hooks
+	defer func() { config.Hooks = hooks }()
+
+	out := filepath.Join(t.TempDir(), "out")
+	config.Hooks = map[string]hook{
+		OnRate:       {Cmd: `sh -c 'echo "{{.Artist}}|$PLAQUE_ALBUM|{{.Rating}}" > ` + out + `'`},
+		OnResumeQuit: {Cmd: `cp {{ .Path }} ` + out},
+		BeforePlay:   {Cmd: "false", OnFailure: "block"},
+		AfterPlay:    {Cmd: "false", OnFailure: "warn"},
+		OnDelete:     {Cmd: "sleep 1", Timeout: 10 * time.Millisecond, OnFailure: "block"},
+	}
+
+	assert.Nil(t, runHook(OnRate, hookVars{Artist: "a b", Album: "c", Rating: 3}))
+	b, _ := os.ReadFile(out)
+	assert.Equal(t, string(b), "a b|c|3\n")
+
+	// unquoted values are a single arg
+	src := filepath.Join(t.TempDir(), "a b")
+	_ = os.WriteFile(src, []byte("x"), 0644)
+	assert.Nil(t, runHook(OnResumeQuit, hookVars{Path: src}))
+	b, _ = os.ReadFile(out)
+	assert.Equal(t, string(b), "x")
+
+	assert.NotNil(t, runHook(BeforePlay, hookVars{}))
+	assert.Nil(t, runHook(AfterPlay, hookVars{}))
+	assert.ErrorContains(t, runHook(OnDelete, hookVars{}), "timed out")
+	assert.Nil(t, runHook(OnQueueChange, hookVars{})) // not configured
+}
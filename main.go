@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -13,12 +16,27 @@ func main() {
 	lf, _ := tea.LogToFile("/tmp/tea.log", "plaque")
 	defer lf.Close()
 
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			lf.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	go autoPurgeTrash()
+	go func() {
+		syncOutbox()
+		autoRefreshMirror()
+	}()
+
 	// browseArtists(discogsSearchArtist("rira")).rate()
 	// return
 
 	// WithAltScreen should always be used, to avoid janky rendering
 	var p tea.Model
-	switch mpvRunning() {
+	switch player.Running() {
 	case true:
 		p = artistBrowser()
 	case false:
@@ -0,0 +1,126 @@
+// Confirmed matches between the library and Discogs, so that later lookups
+// are a direct GET, instead of a search (and possibly a disambiguation by the
+// user). Artists are keyed by artist dir, albums by relpath:
+//
+//	{
+//		"artists": {"Metallica": 18839},
+//		"albums": {"Metallica/Ride the Lightning (1984)": {"id": 6440, "master": true}}
+//	}
+//
+// Mappings are kept in a single json file in the state dir, and can be edited
+// (or cleared) in the Browser with ctrl+e. Renaming a dir orphans its mapping,
+// which is harmless.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"plaque/discogs"
+)
+
+type mappedRelease struct {
+	Id     int  `json:"id"`
+	Master bool `json:"master"`
+}
+
+func (m mappedRelease) String() string {
+	if m.Master {
+		return fmt.Sprintf("master/%d", m.Id)
+	}
+	return fmt.Sprintf("release/%d", m.Id)
+}
+
+// Fetch the release (or master)
+func (m mappedRelease) get() (discogs.Release, error) {
+	if m.Master {
+		return discogs.GetMaster(m.Id)
+	}
+	return discogs.GetRelease(m.Id)
+}
+
+type discogsMapping struct {
+	Artists map[string]int           `json:"artists"`
+	Albums  map[string]mappedRelease `json:"albums"`
+}
+
+func mappingPath() string { return statePath("discogs.json") }
+
+func readMapping() discogsMapping {
+	m := discogsMapping{
+		Artists: make(map[string]int),
+		Albums:  make(map[string]mappedRelease),
+	}
+	b, err := os.ReadFile(mappingPath())
+	if err != nil {
+		return m
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		log.Println("invalid mapping file:", err)
+	}
+	return m
+}
+
+func (m discogsMapping) write() error {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(mappingPath(), b, 0644)
+}
+
+// Remember the release of an album. A zero id clears the mapping.
+func mapAlbum(relpath string, rel mappedRelease) error {
+	m := readMapping()
+	if rel.Id == 0 {
+		delete(m.Albums, relpath)
+	} else {
+		m.Albums[relpath] = rel
+	}
+	log.Println("mapped:", relpath, rel)
+	return m.write()
+}
+
+// Remember the Discogs artist of an artist dir. A zero id clears the mapping.
+func mapArtist(artist string, id int) error {
+	m := readMapping()
+	if id == 0 {
+		delete(m.Artists, artist)
+	} else {
+		m.Artists[artist] = id
+	}
+	log.Println("mapped:", artist, id)
+	return m.write()
+}
+
+// Masters have a main release; full releases do not
+func releaseMapping(r discogs.Release) mappedRelease {
+	return mappedRelease{Id: r.Id, Master: r.Primary > 0}
+}
+
+// Set the mapping of item (an artist dir in Artists mode, otherwise a relpath)
+// from a Discogs url; an empty url clears it
+func editMapping(item string, mode Mode, url string) error {
+	if url == "" {
+		if mode == Artists {
+			return mapArtist(item, 0)
+		}
+		return mapAlbum(item, mappedRelease{})
+	}
+
+	kind, id, err := discogs.ParseURL(url)
+	if err != nil {
+		return err
+	}
+	switch {
+	case mode == Artists && kind == "artist":
+		return mapArtist(item, id)
+	case mode != Artists && kind != "artist":
+		return mapAlbum(item, mappedRelease{Id: id, Master: kind == "master"})
+	default:
+		return fmt.Errorf("cannot map %s to %s", item, kind)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapping(t *testing.T) {
+	state := config.StateDir
+	defer func() { config.StateDir = state }()
+	config.StateDir = t.TempDir()
+
+	assert.Empty(t, readMapping().Albums)
+
+	assert.Nil(t, editMapping("A", Artists, "https://www.discogs.com/artist/18839-Metallica"))
+	assert.Nil(t, editMapping("A/x", Albums, "release/377464"))
+	assert.NotNil(t, editMapping("A", Artists, "master/6440"))
+	assert.NotNil(t, editMapping("A/x", Queue, "6440"))
+
+	m := readMapping()
+	assert.Equal(t, m.Artists["A"], 18839)
+	assert.Equal(t, m.Albums["A/x"], mappedRelease{Id: 377464})
+	assert.Equal(t, m.Albums["A/x"].String(), "release/377464")
+
+	assert.Nil(t, editMapping("A", Artists, ""))
+	assert.Nil(t, editMapping("A/x", Queue, ""))
+	m = readMapping()
+	assert.Empty(t, m.Artists)
+	assert.Empty(t, m.Albums)
+}
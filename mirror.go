@@ -0,0 +1,190 @@
+// Local mirror of the user's Discogs collection and ratings, so that the
+// Browser can show badges (e.g. "★4") for mapped albums, and the rating
+// sampler can favour well-rated albums, without making any requests.
+//
+// The mirror is rebuilt from the collection (all folders) in the background
+// when it is older than a day, and fully by `plaque discogs sync`, which also
+// fetches the ratings of mapped releases that are not in the collection (one
+// request per release). Ratings made in plaque are added immediately.
+//
+// Masters cannot be rated or collected, so a master mapping gets the rating of
+// any collected release of the master.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"plaque/discogs"
+)
+
+const mirrorMaxAge = 24 * time.Hour
+
+type mirrorEntry struct {
+	Rating    int  `json:"rating,omitempty"` // 0 if not rated
+	Collected bool `json:"collected,omitempty"`
+}
+
+func (e mirrorEntry) badge() string {
+	switch {
+	case e.Rating > 0:
+		return "★" + strconv.Itoa(e.Rating)
+	case e.Collected:
+		return "in collection"
+	default:
+		return ""
+	}
+}
+
+type discogsMirror struct {
+	Synced   time.Time           `json:"synced"`
+	Releases map[int]mirrorEntry `json:"releases"`
+	Masters  map[int]mirrorEntry `json:"masters"`
+}
+
+func mirrorPath() string { return statePath("discogs_mirror.json") }
+
+func newMirror() discogsMirror {
+	return discogsMirror{
+		Releases: make(map[int]mirrorEntry),
+		Masters:  make(map[int]mirrorEntry),
+	}
+}
+
+func readMirror() discogsMirror {
+	m := newMirror()
+	b, err := os.ReadFile(mirrorPath())
+	if err != nil {
+		return m
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		log.Println("invalid mirror file:", err)
+	}
+	return m
+}
+
+func (m discogsMirror) write() error {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(mirrorPath(), b, 0644)
+}
+
+// Record a rating of a release (and its master, if any). A master entry is
+// only replaced by a higher rating, since a master may be collected in several
+// releases.
+func (m discogsMirror) set(id int, master int, e mirrorEntry) {
+	m.Releases[id] = e
+	if master == 0 {
+		return
+	}
+	if prev, ok := m.Masters[master]; ok {
+		e.Rating = max(e.Rating, prev.Rating)
+		e.Collected = e.Collected || prev.Collected
+	}
+	m.Masters[master] = e
+}
+
+func (m discogsMirror) entry(rel mappedRelease) mirrorEntry {
+	if rel.Master {
+		return m.Masters[rel.Id]
+	}
+	return m.Releases[rel.Id]
+}
+
+// Badge of a mapped album; empty if unmapped, or neither rated nor collected
+func (m discogsMirror) badge(rel mappedRelease) string { return m.entry(rel).badge() }
+
+// Discogs ratings of mapped albums, falling back to local ratings, keyed by
+// relpath
+func albumRatings() map[string]int {
+	ratings := readLocalRatings()
+	mirror := readMirror()
+	for relpath, rel := range readMapping().Albums {
+		if r := mirror.entry(rel).Rating; r > 0 {
+			ratings[relpath] = r
+		}
+	}
+	return ratings
+}
+
+// Rebuild the mirror from the collection, and pending ratings in the outbox.
+// If ratings is true, the ratings of mapped releases that are not in the
+// collection are also fetched. Returns the number of releases in the mirror.
+func refreshMirror(ratings bool) (int, error) {
+	m := newMirror()
+	for item, err := range discogs.IterCollection() {
+		if err != nil {
+			return 0, err
+		}
+		m.set(item.Id, item.BasicInformation.MasterId, mirrorEntry{Rating: item.Rating, Collected: true})
+	}
+
+	if ratings {
+		for relpath, rel := range readMapping().Albums {
+			if _, ok := m.Releases[rel.Id]; ok || rel.Master {
+				continue
+			}
+			rating, err := discogs.GetRating(rel.Id)
+			switch {
+			case fatalMatchError(err):
+				return 0, err
+			case err != nil:
+				log.Println("could not get rating:", relpath, err)
+			case rating > 0:
+				m.Releases[rel.Id] = mirrorEntry{Rating: rating}
+			}
+		}
+	}
+
+	// not delivered yet, so neither in the collection, nor rated on
+	// Discogs. the master is unknown
+	if discogs.Default.Outbox != nil {
+		pending, err := discogs.Default.Outbox.Pending()
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range pending {
+			m.Releases[p.ReleaseId] = mirrorEntry{Rating: p.Rating}
+		}
+	}
+
+	m.Synced = time.Now()
+	return len(m.Releases), m.write()
+}
+
+// Refresh the mirror (collection only) if it is stale
+func autoRefreshMirror() {
+	if !discogsEnabled || time.Since(readMirror().Synced) < mirrorMaxAge {
+		return
+	}
+	n, err := refreshMirror(false)
+	if err != nil {
+		log.Println("could not refresh mirror:", err)
+		return
+	}
+	log.Println("refreshed mirror:", n, "releases")
+}
+
+// Record a rating made in plaque. rel is the mapped release, which may be a
+// master.
+func mirrorRated(rel *discogs.Release, rating int) error {
+	m := readMirror()
+	e := mirrorEntry{Rating: rating, Collected: true}
+	switch {
+	case rel.Primary > 0:
+		m.set(rel.Primary, rel.Id, e)
+	default:
+		m.set(rel.Id, rel.MasterId, e)
+	}
+	if err := m.write(); err != nil {
+		return fmt.Errorf("could not update mirror: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"plaque/discogs"
+	"plaque/discogs/discogstest"
+)
+
+func TestMirror(t *testing.T) {
+	state, d := config.StateDir, discogs.Default
+	defer func() { config.StateDir, discogs.Default = state, d }()
+	config.StateDir = t.TempDir()
+	discogs.Default = discogstest.NewClient(t, "discogs/testdata")
+
+	assert.Nil(t, mapAlbum("Metallica/Ride the Lightning", mappedRelease{Id: 6440, Master: true}))
+	assert.Nil(t, mapAlbum("natsumen/kill your winter", mappedRelease{Id: 12578164}))
+	assert.Nil(t, mapAlbum("X/y", mappedRelease{Id: 1, Master: true}))
+
+	n, err := refreshMirror(true)
+	assert.Nil(t, err)
+	assert.Equal(t, n, 2)
+
+	m := readMirror()
+	albums := readMapping().Albums
+	assert.False(t, m.Synced.IsZero())
+	assert.Equal(t, m.badge(albums["Metallica/Ride the Lightning"]), "★4")
+	assert.Equal(t, m.badge(albums["natsumen/kill your winter"]), "in collection")
+	assert.Equal(t, m.badge(albums["X/y"]), "")
+	assert.Equal(t, m.badge(albums["unmapped"]), "")
+
+	// rated in plaque; the master keeps the highest rating
+	assert.Nil(t, mirrorRated(&discogs.Release{Id: 12578164}, 2))
+	assert.Nil(t, mirrorRated(&discogs.Release{Id: 1, Primary: 10}, 5))
+	m = readMirror()
+	assert.Equal(t, m.badge(albums["natsumen/kill your winter"]), "★2")
+	assert.Equal(t, m.badge(albums["X/y"]), "★5")
+	assert.Equal(t, m.Releases[10].Rating, 5)
+
+	assert.Equal(t, albumRatings(), map[string]int{
+		"Metallica/Ride the Lightning": 4,
+		"natsumen/kill your winter":    2,
+		"X/y":                          5,
+	})
+
+	// every rating path goes through rated, e.g. an artist release (master)
+	// rated while browsing
+	p := postPlayback{}
+	assert.Nil(t, p.rated(hookVars{}, &discogs.Release{Id: 1, Primary: 11, Artist: "X"}, 3))
+	assert.Nil(t, p.rated(hookVars{}, &discogs.Release{Id: 20, Artist: "X"}, 1))
+	m = readMirror()
+	assert.Equal(t, m.Releases[11].Rating, 3)
+	assert.Equal(t, m.Masters[1].Rating, 5) // highest
+	assert.Equal(t, m.Releases[20].Rating, 1)
+}
+
+func TestWeightedSample(t *testing.T) {
+	relpaths := []string{"a", "b", "c"}
+	ratings := map[string]int{"a": 1, "c": 5} // b is unrated
+
+	first := make(map[string]int)
+	for range 3000 {
+		ranked := weightedSample(relpaths, ratings)
+		assert.ElementsMatch(t, ranked, relpaths)
+		first[ranked[0]]++
+	}
+	assert.Equal(t, relpaths, []string{"a", "b", "c"}) // unmodified
+	assert.Less(t, first["a"], first["b"])
+	assert.Less(t, first["b"], first["c"])
+}
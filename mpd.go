@@ -0,0 +1,218 @@
+// MPD backend. Only a tiny subset of the protocol is implemented; there is no
+// need for a full client library.
+//
+// https://mpd.readthedocs.io/en/latest/protocol.html
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type mpdConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialMpd() (*mpdConn, error) {
+	network := "tcp"
+	if strings.HasPrefix(config.Mpd.Address, "/") {
+		network = "unix"
+	}
+	conn, err := net.DialTimeout(network, config.Mpd.Address, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &mpdConn{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "OK MPD ") {
+		conn.Close()
+		return nil, fmt.Errorf("not mpd: %q", greeting)
+	}
+
+	if config.Mpd.Password != "" {
+		if _, err := c.cmd("password", config.Mpd.Password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *mpdConn) Close() error { return c.conn.Close() }
+
+func mpdQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// Send a command, and return the key-value pairs of the response. Repeated
+// keys are overwritten, which is fine for the commands we need.
+func (c *mpdConn) cmd(name string, args ...string) (map[string]string, error) {
+	line := name
+	for _, a := range args {
+		line += " " + mpdQuote(a)
+	}
+	if _, err := io.WriteString(c.conn, line+"\n"); err != nil {
+		return nil, err
+	}
+
+	resp := make(map[string]string)
+	for {
+		l, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		l = strings.TrimSuffix(l, "\n")
+		switch {
+		case l == "OK":
+			return resp, nil
+		case strings.HasPrefix(l, "ACK "):
+			return nil, errors.New(l)
+		}
+		k, v, _ := strings.Cut(l, ": ")
+		resp[k] = v
+	}
+}
+
+type mpdPlayer struct{}
+
+// Convert a fullpath under library root to a uri under mpd's music directory
+func mpdUri(fullpath string) string {
+	rel, _ := filepath.Rel(config.Library.Root, fullpath)
+	return path.Join(config.Mpd.MusicDir, filepath.ToSlash(rel))
+}
+
+type mpdCmd struct {
+	path  string
+	track int
+}
+
+func (c mpdCmd) Run() error {
+	tracks, err := albumTracks(c.path)
+	if err != nil {
+		return err
+	}
+	if len(tracks) == 0 {
+		return fmt.Errorf("no tracks: %s", c.path)
+	}
+
+	conn, err := dialMpd()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if !config.Mpd.Append {
+		if _, err := conn.cmd("clear"); err != nil {
+			return err
+		}
+	}
+	status, err := conn.cmd("status")
+	if err != nil {
+		return err
+	}
+	first, _ := strconv.Atoi(status["playlistlength"])
+
+	for _, t := range tracks {
+		if _, err := conn.cmd("add", mpdUri(t)); err != nil {
+			return err
+		}
+	}
+	if _, err := conn.cmd("play", strconv.Itoa(first+min(c.track, len(tracks)-1))); err != nil {
+		return err
+	}
+
+	// the terminal is ours, but mpd is controlled elsewhere
+	fmt.Println("playing via mpd:", c.path)
+	fmt.Println("waiting for playback to stop...")
+
+	s := newListenSession(tracks)
+	defer s.record(c.path)
+	cur := min(c.track, len(tracks)-1)
+	s.play(cur)
+
+	// playback is considered done when mpd stops, or moves past the
+	// album's tracks
+	for {
+		if _, err := conn.cmd("idle", "player"); err != nil {
+			return err
+		}
+		status, err := conn.cmd("status")
+		if err != nil {
+			return err
+		}
+		song, err := strconv.Atoi(status["song"])
+		if err != nil { // end of playlist
+			s.finish()
+			log.Println("mpd playback done:", status["state"])
+			return nil
+		}
+		song -= first
+		if song != cur {
+			// only natural advance counts as being heard
+			if song == cur+1 {
+				s.finish()
+			}
+			cur = song
+			s.play(cur)
+		}
+		if status["state"] == "stop" || song < 0 || song >= len(tracks) {
+			log.Println("mpd playback done:", status["state"], song)
+			return nil
+		}
+	}
+}
+
+func (mpdCmd) SetStdin(io.Reader) {}
+
+func (mpdCmd) SetStdout(io.Writer) {}
+
+func (mpdCmd) SetStderr(io.Writer) {}
+
+func (mpdPlayer) Start(path string, track int) tea.ExecCommand {
+	return mpdCmd{path: path, track: track}
+}
+
+func (mpdPlayer) Stop() error {
+	conn, err := dialMpd()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.cmd("stop")
+	return err
+}
+
+func (mpdPlayer) Running() bool {
+	conn, err := dialMpd()
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	status, err := conn.cmd("status")
+	return err == nil && status["state"] == "play"
+}
+
+// mpd has no equivalent of mpv's watch_later
+func (mpdPlayer) Resumes() []string { return nil }
+
+func (mpdPlayer) WillResume(string) bool { return false }
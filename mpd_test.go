@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Minimal stand-in for mpd. Each status response is popped from statuses; all
+// received commands are recorded.
+func fakeMpd(t *testing.T, statuses []string) (addr string, cmds chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	cmds = make(chan string, 100)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				fmt.Fprint(conn, "OK MPD 0.23.5\n")
+				sc := bufio.NewScanner(conn)
+				for sc.Scan() {
+					line := sc.Text()
+					cmds <- line
+					switch {
+					case line == "status" && len(statuses) > 0:
+						fmt.Fprint(conn, statuses[0])
+						statuses = statuses[1:]
+					case strings.HasPrefix(line, "idle"):
+						fmt.Fprint(conn, "changed: player\n")
+					}
+					fmt.Fprint(conn, "OK\n")
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), cmds
+}
+
+func TestMpd(t *testing.T) {
+	root, state, mpd := config.Library.Root, config.StateDir, config.Mpd
+	defer func() { config.Library.Root, config.StateDir, config.Mpd = root, state, mpd }()
+
+	config.Library.Root = t.TempDir()
+	config.StateDir = t.TempDir()
+	album := filepath.Join(config.Library.Root, "a", "b")
+	_ = os.MkdirAll(filepath.Join(album, "CD2"), 0755)
+	for _, f := range []string{"01.flac", "cover.jpg", "CD2/01.flac"} {
+		_ = os.WriteFile(filepath.Join(album, f), nil, 0644)
+	}
+
+	addr, cmds := fakeMpd(t, []string{
+		"playlistlength: 0\n",
+		"state: play\nsong: 1\n",
+		"state: stop\n",
+	})
+	config.Mpd.Address = addr
+	config.Mpd.MusicDir = "music"
+	config.Mpd.Append = false
+
+	assert.Nil(t, mpdPlayer{}.Start(album, 1).Run())
+	close(cmds)
+	var got []string
+	for c := range cmds {
+		got = append(got, c)
+	}
+	assert.Equal(t, got, []string{
+		"clear",
+		"status",
+		`add "music/a/b/01.flac"`,
+		`add "music/a/b/CD2/01.flac"`,
+		`play "1"`,
+		`idle "player"`,
+		"status",
+		`idle "player"`,
+		"status",
+	})
+	// started at the 2nd track, which ran to the end of the playlist
+	assert.Equal(t, readProgress()["a/b"].Heard, []int{1})
+	assert.Equal(t, readProgress()["a/b"].String(), "partial 1/2")
+
+	addr, _ = fakeMpd(t, []string{"state: play\n"})
+	config.Mpd.Address = addr
+	assert.True(t, mpdPlayer{}.Running())
+}
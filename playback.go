@@ -1,8 +1,8 @@
-// Playback and queue management. Playback is delegated to mpv, which is
-// allowed to run in a blocking manner for full keyboard control. As such,
-// multiple instances of the program are to be expected, but only one instance
-// can be running mpv; other instances can only add to queue, and terminate
-// immediately.
+// Playback and queue management. Playback is delegated to a Player (mpv by
+// default), which is allowed to run in a blocking manner for full keyboard
+// control. As such, multiple instances of the program are to be expected, but
+// only one instance can be running the player; other instances can only add to
+// queue, and terminate immediately.
 //
 // Scrobbling is out of scope of this program; consider
 // https://github.com/Feqzz/mpv-lastfm-scrobbler
@@ -10,116 +10,23 @@
 package main
 
 import (
-	"bufio"
-	"fmt"
+	"errors"
 	"io"
-	"io/fs"
 	"log"
-	"math/rand/v2"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
-
-	"plaque/discogs"
 )
 
 const QueueCount = 5
 
-func mpvRunning() bool {
-	// https://github.com/mitchellh/go-ps/blob/master/process_linux.go
-	running := false
-	_ = filepath.WalkDir("/proc", func(path string, d fs.DirEntry, err error) error {
-		if d.IsDir() || filepath.Base(path) != "stat" {
-			return nil
-		}
-		b, e := os.ReadFile(path)
-		if e != nil {
-			panic(e)
-		}
-
-		s := string(b)
-		start := strings.IndexRune(s, '(')
-		end := strings.IndexRune(s, ')')
-		if end < 0 {
-			return nil
-		}
-		if s[start+1:end] == "mpv" {
-			running = true
-			return fs.SkipAll
-		}
-		return nil
-	})
-	return running
-}
-
-func getResumes() *[]string {
-	// When mpv is quit with the `quit_watch_later` command, a file is
-	// written to this dir, containing the full path to the file.
-
-	if config == nil {
-		panic("init was not done")
-	}
-
-	var resumes []string
-	err := filepath.WalkDir(
-		config.Mpv.WatchLaterDir,
-		func(path string, d fs.DirEntry, err error) error {
-			if d.IsDir() {
-				return nil
-			}
-
-			fo, _ := os.Open(path)
-			defer fo.Close()
-			sc := bufio.NewScanner(fo)
-			sc.Scan() // only need to read 1st line
-			line := sc.Text()
-
-			file := line[2:] // # "# "
-			if fi, e := os.Stat(file); e == nil &&
-				!fi.IsDir() &&
-				strings.HasPrefix(file, config.Library.Root) {
-				rel, _ := filepath.Rel(config.Library.Root, filepath.Dir(file))
-				resumes = append(resumes, rel)
-			}
-			return nil
-		},
-	)
-	if err != nil {
-		panic(err)
-	}
-	if len(resumes) == 0 {
-		return nil
-	}
-	return &resumes
-}
-
-func willResume(relpath string) (resume bool) {
-	path := filepath.Join(config.Library.Root, relpath)
-	_ = filepath.WalkDir(config.Mpv.WatchLaterDir, func(p string, d fs.DirEntry, _ error) error {
-		if d.IsDir() {
-			return nil
-		}
-		b, err := os.ReadFile(p)
-		if err != nil {
-			panic(err)
-		}
-		if strings.Contains(string(b), path) {
-			resume = true
-			return fs.SkipAll
-		}
-		return nil
-	})
-	return resume
-}
-
-// Select n random items from the queue file (containing relpaths), and return
-// them as fullpaths
+// Select n items from the queue file (containing relpaths) with the active
+// sampler, and return them as relpaths
 //
-// If n = 0, the entire queue is returned without shuffling
+// If n = 0, the entire queue is returned without sampling
 func getQueue(n int) []string {
 	if n < 0 {
 		panic("invalid")
@@ -138,19 +45,15 @@ func getQueue(n int) []string {
 	}
 	relpaths := strings.Split(string(b), "\n")
 
-	// TODO: split off sampling
+	// 'valid' text file should always end with a trailing newline. in
+	// this case, last element will be empty string
+	relpaths = relpaths[:len(relpaths)-1]
+
 	switch n {
 	case 0:
-		// 'valid' text file should always end with a trailing newline.
-		// in this case, last element will be empty string
-		return relpaths[:len(relpaths)-1]
+		return relpaths
 	default:
-		var sel []string
-		idxs := rand.Perm(len(relpaths) - 1)
-		for _, idx := range idxs[:n] {
-			sel = append(sel, relpaths[idx])
-		}
-		return sel
+		return activeSampler()(relpaths)[:min(n, len(relpaths))]
 	}
 }
 
@@ -164,116 +67,44 @@ func writeQueue(items []string) {
 	if err != nil {
 		panic(err)
 	}
+	_ = runHook(OnQueueChange, hookVars{Path: config.Library.Queue})
 }
 
 // https://github.com/picosh/pico/blob/4632c9cd3d7bc37c9c0c92bdc3dc8a64928237d8/tui/senpai.go#L10
 
+// Returned by postPlaybackCmd when playback was interrupted, and will be
+// resumed; no further post-playback actions are taken
+var errResume = errors.New("will resume")
+
+// Sent to the Browser in place of errResume
+type resumeMsg struct{ relpath string }
+
 // wrapper to call functions in a blocking manner (via Run)
-type postPlaybackCmd struct{ relpath string }
+type postPlaybackCmd struct {
+	relpath string
+	track   int // first track played
+	start   time.Time
+}
 
 // required methods for tea.ExecCommand
 
 func (c *postPlaybackCmd) Run() error {
-	if willResume(c.relpath) {
-		// we -could- propagate some error to tea.Exec, which can be
-		// handled there. for practical purposes, all we need to do is
-		// just return to Queue
+	if player.WillResume(c.relpath) {
 		log.Println("will resume:", c.relpath)
-		os.Exit(0)
-		return nil
-		// // TODO: figure out how to return a 'real' error
-		// return fmt.Errorf("resume")
+		emit(PlayEnd, newHookVars(c.relpath), "resume")
+		recordHistory(c.relpath, c.track, c.start, "resume")
+		_ = runHook(OnResumeQuit, newHookVars(c.relpath))
+		return errResume
 	}
 
 	log.Println("playback done")
-
-	q := getQueue(0)
-	nq := *remove(&q, c.relpath)
-	ensure(len(q)-len(nq) == 1)
-	writeQueue(nq)
-	log.Println("removed:", c.relpath)
-
-	if !discogsEnabled {
-		log.Println("no discogs key, skipping rate")
-		return nil
-	}
-
-	artist, album := filepath.Split(c.relpath)
-
-	// remove possible translation
-	if artist[len(artist)-1] == ')' {
-		i := strings.LastIndex(artist, "(")
-		artist = artist[:i-1]
-	}
-
-	// remove album suffix " (YYYY)"
-	if album[len(album)-1] == ')' {
-		album = album[:len(album)-7]
-	}
-
-	// aside from edge cases, only classical albums have " [performer, ...]" suffix
-	var res discogs.SearchResult
-	if album[len(album)-1] == ']' {
-		res = discogs.Search(movePerfsToArtist(artist, album))
-	} else {
-		res = discogs.Search(artist, album)
-	}
-
-	rel := res.Primary()
-	if rating, _ := rel.Rate(); rating == 1 &&
-		// guard rail to prevent deleting classical artists
-		album[len(album)-1] != ']' {
-		p := filepath.Join(config.Library.Root, artist)
-		if _, err := os.Stat(p); err != nil {
-			return nil
-		}
-
-		fmt.Printf("Delete %s? [y/N] ", artist)
-		var del string
-		_, _ = fmt.Scanln(&del)
-		if del == "y" {
-			_ = os.RemoveAll(p)
-			fmt.Println("Deleted", p)
-		}
-		return nil
-	}
-
-	// this is not terribly ergonomic; but wrapping the returned []Artist
-	// in a struct seems even more annoying
-	artists := discogs.SearchArtist(artist)
-	if len(artists) == 0 {
-		return nil
-	}
-
-	art := discogs.BrowseArtists(artists)
-	if art != nil {
+	emit(PlayEnd, newHookVars(c.relpath), "finished")
+	recordHistory(c.relpath, c.track, c.start, "finished")
+	if err := runHook(AfterPlay, newHookVars(c.relpath)); err != nil {
 		return nil
 	}
 
-	// art.Rate(checkDir) // nonsensical api
-	// art.Rate() // sane api, but no checkDir
-
-	for _, rel := range art.Releases() {
-		// if !rel.IsRateable() || checkDir(artist, rel.Title) {
-		// 	continue
-		// }
-		if checkDir(artist, rel.Title) {
-			continue
-		}
-
-		// if errors.Is(err, discogs.ErrAlreadyRated) {
-		// 	continue
-		// }
-
-		_, err := rel.Rate()
-		switch err {
-		case discogs.ErrAlreadyRated, discogs.ErrNotRateable:
-			continue
-		}
-
-		break
-	}
-
+	runSteps(&postPlayback{relpath: c.relpath, start: c.start})
 	return nil
 }
 
@@ -283,7 +114,27 @@ func (c *postPlaybackCmd) SetStdin(io.Reader) {}
 
 func (c *postPlaybackCmd) SetStdout(io.Writer) {}
 
-func play(relpath string) tea.Cmd {
+// Sent once the before-play hook has run (and did not block)
+type playMsg struct {
+	relpath string
+	track   int
+}
+
+// Run the before-play hook; if it does not block, the Browser starts playback
+// (at the given track) on receiving playMsg.
+func play(relpath string, track int) tea.Cmd {
+	return func() tea.Msg {
+		vars := newHookVars(relpath)
+		if err := runHook(BeforePlay, vars); err != nil {
+			log.Println("playback cancelled:", err)
+			return nil
+		}
+		emit(PlayStart, vars, "")
+		return playMsg{relpath: relpath, track: track}
+	}
+}
+
+func playback(relpath string, track int) tea.Cmd {
 	timer := time.NewTimer(time.Second * 2)
 	defer timer.Stop()
 	go func() {
@@ -294,44 +145,21 @@ func play(relpath string) tea.Cmd {
 
 	// TODO: online mode (search ytm)
 	path := filepath.Join(config.Library.Root, relpath)
-	mpvCmd := exec.Command("mpv", append(strings.Fields(config.Mpv.Args), path)...)
 	log.Println("playing:", path)
 
 	return tea.Sequence(
-		func() tea.Msg {
-			if config.Playback.Before == "" {
-				return nil
-			}
-			args := strings.Fields(config.Playback.Before)
-			var expandedArgs []string
-			for _, arg := range args[1:] {
-				if arg[0] == '$' {
-					arg = os.ExpandEnv(arg)
-				}
-				expandedArgs = append(expandedArgs, arg)
-			}
-			cmd := exec.Command(args[0], expandedArgs...)
-			err := cmd.Run()
-			if err != nil {
-				log.Println("could not run cmd", cmd, err)
-			}
-			return nil
-		},
-		tea.ExecProcess(mpvCmd, nil),
+		tea.Exec(player.Start(path, track), nil),
 		tea.Exec(
-			&postPlaybackCmd{relpath: relpath},
-			nil,
-			// // if you need to check/handle the error returned by
-			// // Run and turn that into a Cmd, you could; otherwise,
-			// // we just return to Queue
-			// func(err error) tea.Msg {
-			// 	// if err.Error() == "resume" {
-			// 	// 	log.Println("quitting and will resume")
-			// 	// 	return tea.Quit()
-			// 	// 	// return nil
-			// 	// }
-			// 	return nil
-			// },
+			&postPlaybackCmd{relpath: relpath, track: track, start: time.Now()},
+			func(err error) tea.Msg {
+				switch {
+				case errors.Is(err, errResume):
+					return resumeMsg{relpath: relpath}
+				case err != nil:
+					log.Println("post-playback:", err)
+				}
+				return nil
+			},
 		),
 		tea.ClearScreen,
 	)
@@ -0,0 +1,325 @@
+// Playback backends. mpv is the default (and most featureful) backend, but
+// anything that can play a directory in a blocking manner will do.
+//
+// Like mpv, a backend is shared by all instances of the program: Running
+// reports playback started by -any- instance.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type Player interface {
+	// Returns a command that plays path (a fullpath), starting at the
+	// given track (index of albumTracks), and blocks until playback is
+	// finished. The command is run with tea.Exec, i.e. the terminal is
+	// released to the player.
+	Start(path string, track int) tea.ExecCommand
+
+	// Stop any ongoing playback
+	Stop() error
+
+	// Whether playback is ongoing
+	Running() bool
+
+	// Relpaths of albums whose playback was interrupted, and should be
+	// resumed. Backends without resume support return nil.
+	Resumes() []string
+
+	// Whether playback of relpath was interrupted (and will be resumed)
+	WillResume(relpath string) bool
+}
+
+var player Player
+
+func newPlayer(backend string) Player {
+	switch backend {
+	case "", "mpv":
+		return mpvPlayer{}
+	case "mpd":
+		return mpdPlayer{}
+	case "command":
+		if config.Player.Command == "" {
+			log.Fatalln("player.command must be set for command backend")
+		}
+		return commandPlayer{command: config.Player.Command}
+	case "null":
+		return nullPlayer{}
+	default:
+		log.Fatalln("invalid player backend:", backend)
+		return nil
+	}
+}
+
+// exec.Cmd does not implement tea.ExecCommand (tea.ExecProcess wraps it
+// privately), so we do the same
+type procCmd struct{ *exec.Cmd }
+
+func (c procCmd) SetStdin(r io.Reader) {
+	if c.Stdin == nil {
+		c.Stdin = r
+	}
+}
+
+func (c procCmd) SetStdout(w io.Writer) {
+	if c.Stdout == nil {
+		c.Stdout = w
+	}
+}
+
+func (c procCmd) SetStderr(w io.Writer) {
+	if c.Stderr == nil {
+		c.Stderr = w
+	}
+}
+
+// Returns pids of all processes with the given name (as reported by
+// /proc/pid/stat, i.e. truncated to 15 chars)
+func findProcs(name string) []int {
+	// https://github.com/mitchellh/go-ps/blob/master/process_linux.go
+	var pids []int
+	_ = filepath.WalkDir("/proc", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // process may have exited
+		}
+		if d.IsDir() {
+			// only descend into /proc/pid
+			if path != "/proc" && filepath.Dir(path) != "/proc" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if filepath.Base(path) != "stat" {
+			return nil
+		}
+		b, e := os.ReadFile(path)
+		if e != nil {
+			return nil
+		}
+
+		s := string(b)
+		start := strings.IndexRune(s, '(')
+		end := strings.LastIndex(s, ")")
+		if start < 0 || end < 0 {
+			return nil
+		}
+		if s[start+1:end] == name {
+			pid, _ := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+			pids = append(pids, pid)
+		}
+		return nil
+	})
+	return pids
+}
+
+func killProcs(name string) error {
+	for _, pid := range findProcs(name) {
+		if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mpv {{{
+
+type mpvPlayer struct{}
+
+// mpv, with track progress reported over its json ipc socket. Note that
+// --input-ipc-server is always set, so any value in mpv.args is overridden.
+//
+// https://mpv.io/manual/stable/#json-ipc
+type mpvCmd struct {
+	procCmd
+	path   string
+	tracks []string
+	socket string
+}
+
+func (c mpvCmd) Run() error {
+	_ = os.Remove(c.socket)
+	if err := c.Cmd.Start(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan *listenSession)
+	go func() { done <- watchMpv(ctx, c.socket, c.tracks) }()
+
+	err := c.Wait()
+	cancel()
+	if s := <-done; s != nil {
+		s.record(c.path)
+	}
+	return err
+}
+
+// Follow playback until mpv exits. Returns nil if the socket could not be
+// connected to.
+func watchMpv(ctx context.Context, socket string, tracks []string) *listenSession {
+	var conn net.Conn
+	for conn == nil {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(100 * time.Millisecond):
+		}
+		conn, _ = net.Dial("unix", socket)
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, `{"command":["observe_property",1,"path"]}`+"\n"); err != nil {
+		return nil
+	}
+
+	s := newListenSession(tracks)
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		var msg struct {
+			Event  string
+			Name   string
+			Data   any
+			Reason string
+		}
+		if json.Unmarshal(sc.Bytes(), &msg) != nil {
+			continue
+		}
+		switch {
+		case msg.Event == "property-change" && msg.Name == "path":
+			if p, ok := msg.Data.(string); ok {
+				s.play(slices.Index(tracks, p))
+			}
+		case msg.Event == "end-file" && msg.Reason == "eof":
+			s.finish()
+		}
+	}
+	return s
+}
+
+func (mpvPlayer) Start(path string, track int) tea.ExecCommand {
+	args := strings.Fields(config.Mpv.Args)
+	socket := statePath("mpv.sock")
+	args = append(args, "--input-ipc-server="+socket)
+	tracks, _ := albumTracks(path)
+	c := mpvCmd{path: path, tracks: tracks, socket: socket}
+	if track == 0 || track >= len(tracks) {
+		c.procCmd = procCmd{exec.Command("mpv", append(args, path)...)}
+		return c
+	}
+	// mpv's directory expansion does not necessarily sort the same way
+	// we do, so the tracks are passed explicitly
+	args = append(args, "--playlist-start="+strconv.Itoa(track))
+	c.procCmd = procCmd{exec.Command("mpv", append(args, tracks...)...)}
+	return c
+}
+
+func (mpvPlayer) Stop() error { return killProcs("mpv") }
+
+func (mpvPlayer) Running() bool { return len(findProcs("mpv")) > 0 }
+
+func (mpvPlayer) Resumes() []string { return getResumes() }
+
+func (mpvPlayer) WillResume(relpath string) bool { return willResume(relpath) }
+
+// }}}
+// command {{{
+
+// Arbitrary command, e.g. `ffplay -nodisp -autoexit {{.Path}}`. The command
+// is split on whitespace -before- templating, so paths containing spaces are
+// passed as a single arg. Available fields: Path (album), Track (index), File
+// (fullpath of starting track; same as Path if unknown).
+type commandPlayer struct{ command string }
+
+type commandVars struct {
+	Path  string
+	Track int
+	File  string
+}
+
+func (c commandPlayer) args(vars commandVars) []string {
+	var args []string
+	for _, f := range strings.Fields(c.command) {
+		t, err := template.New("").Parse(f)
+		if err != nil {
+			log.Println("invalid template:", f, err)
+			args = append(args, f)
+			continue
+		}
+		var buf bytes.Buffer
+		_ = t.Execute(&buf, vars)
+		args = append(args, buf.String())
+	}
+	return args
+}
+
+func (c commandPlayer) Start(path string, track int) tea.ExecCommand {
+	vars := commandVars{Path: path, Track: track, File: path}
+	if tracks, _ := albumTracks(path); track < len(tracks) {
+		vars.File = tracks[track]
+	}
+	args := c.args(vars)
+	return procCmd{exec.Command(args[0], args[1:]...)}
+}
+
+func (c commandPlayer) name() string {
+	return filepath.Base(strings.Fields(c.command)[0])
+}
+
+func (c commandPlayer) Stop() error { return killProcs(c.name()) }
+
+func (c commandPlayer) Running() bool { return len(findProcs(c.name())) > 0 }
+
+func (commandPlayer) Resumes() []string { return nil }
+
+func (commandPlayer) WillResume(string) bool { return false }
+
+// }}}
+// null {{{
+
+// Plays nothing, and returns immediately. Useful for dry runs and testing the
+// post-playback flow.
+type nullPlayer struct{}
+
+type nullCmd struct{ path string }
+
+func (c nullCmd) Run() error {
+	log.Println("null playback:", c.path)
+	return nil
+}
+
+func (nullCmd) SetStdin(io.Reader) {}
+
+func (nullCmd) SetStdout(io.Writer) {}
+
+func (nullCmd) SetStderr(io.Writer) {}
+
+func (nullPlayer) Start(path string, _ int) tea.ExecCommand { return nullCmd{path: path} }
+
+func (nullPlayer) Stop() error { return nil }
+
+func (nullPlayer) Running() bool { return false }
+
+func (nullPlayer) Resumes() []string { return nil }
+
+func (nullPlayer) WillResume(string) bool { return false }
+
+// }}}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandPlayer(t *testing.T) {
+	c := commandPlayer{command: "ffplay -nodisp -autoexit {{.Path}}"}
+	assert.Equal(
+		t,
+		c.args(commandVars{Path: "/a b/c"}),
+		[]string{"ffplay", "-nodisp", "-autoexit", "/a b/c"},
+	)
+	assert.Equal(t, c.name(), "ffplay")
+}
+
+// With the null player, the entire post-playback flow can be run without any
+// user interaction
+func TestNullPlayback(t *testing.T) {
+	queue, state, p, d := config.Library.Queue, config.StateDir, player, discogsEnabled
+	defer func() {
+		config.Library.Queue, config.StateDir, player, discogsEnabled = queue, state, p, d
+	}()
+
+	config.Library.Queue = filepath.Join(t.TempDir(), "queue")
+	config.StateDir = t.TempDir()
+	player = nullPlayer{}
+	discogsEnabled = false
+
+	writeQueue([]string{"a/b", "c/d"})
+	assert.Nil(t, player.Start("a/b", 0).Run())
+	assert.Nil(t, (&postPlaybackCmd{relpath: "a/b"}).Run())
+	assert.Equal(t, getQueue(0), []string{"c/d"})
+}
+
+type resumingPlayer struct{ nullPlayer }
+
+func (resumingPlayer) WillResume(string) bool { return true }
+
+func TestResumeQuit(t *testing.T) {
+	queue, state, p, r := config.Library.Queue, config.StateDir, player, config.Playback.OnResume
+	defer func() {
+		config.Library.Queue, config.StateDir, player, config.Playback.OnResume = queue, state, p, r
+	}()
+
+	config.Library.Queue = filepath.Join(t.TempDir(), "queue")
+	config.StateDir = t.TempDir()
+	player = resumingPlayer{}
+
+	writeQueue([]string{"a/b", "c/d"})
+	assert.ErrorIs(t, (&postPlaybackCmd{relpath: "a/b"}).Run(), errResume)
+	assert.Equal(t, getQueue(0), []string{"a/b", "c/d"})
+	h, _ := readHistory()
+	assert.Equal(t, h[0].Outcome, "resume")
+
+	// returning to Queue requires a terminal
+	config.Playback.OnResume = "quit"
+	_, cmd := (&Browser{}).Update(resumeMsg{relpath: "a/b"})
+	assert.Equal(t, cmd(), tea.QuitMsg{})
+}
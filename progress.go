@@ -0,0 +1,142 @@
+// Per-album listening progress. Backends that can report track changes (mpv,
+// mpd) record which tracks of an album were heard to the end, and which track
+// was playing when playback was stopped. Progress accumulates across
+// playbacks (e.g. when resuming) until the album is fully played, after which
+// the next playback starts afresh.
+//
+// Progress is kept in a single json file in the state dir, keyed by relpath.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+type albumProgress struct {
+	Tracks int   `json:"tracks"`
+	Heard  []int `json:"heard"` // indices of albumTracks, sorted
+	// track that was playing when playback was stopped; -1 if playback
+	// ran to the end
+	Stopped int       `json:"stopped"`
+	Time    time.Time `json:"time"`
+}
+
+// An unknown track count (0) is never played
+func (p albumProgress) played() bool { return p.Tracks > 0 && len(p.Heard) >= p.Tracks }
+
+// Short description, suitable for display next to an item
+func (p albumProgress) String() string {
+	switch {
+	case p.played():
+		return "played"
+	case p.Stopped >= 0:
+		return fmt.Sprintf("abandoned at %d/%d", p.Stopped+1, p.Tracks)
+	default:
+		return fmt.Sprintf("partial %d/%d", len(p.Heard), p.Tracks)
+	}
+}
+
+func progressPath() string { return statePath("progress.json") }
+
+func readProgress() map[string]albumProgress {
+	progress := make(map[string]albumProgress)
+	b, err := os.ReadFile(progressPath())
+	if err != nil {
+		return progress
+	}
+	if err := json.Unmarshal(b, &progress); err != nil {
+		log.Println("invalid progress file:", err)
+	}
+	return progress
+}
+
+// Tracks heard during a single playback
+type listenSession struct {
+	tracks  []string
+	heard   map[int]bool
+	current int // -1 if nothing is playing
+}
+
+func newListenSession(tracks []string) *listenSession {
+	return &listenSession{tracks: tracks, heard: make(map[int]bool), current: -1}
+}
+
+// Track i started playing. Out of range indices (e.g. tracks from another
+// album) are ignored.
+func (s *listenSession) play(i int) {
+	if i < 0 || i >= len(s.tracks) {
+		i = -1
+	}
+	s.current = i
+}
+
+// The current track was played to the end
+func (s *listenSession) finish() {
+	if s.current >= 0 {
+		s.heard[s.current] = true
+	}
+	s.current = -1
+}
+
+// Merge the session into the stored progress of an album (fullpath)
+func (s *listenSession) record(path string) {
+	relpath, err := filepath.Rel(config.Library.Root, path)
+	if err != nil {
+		return
+	}
+
+	all := readProgress()
+	heard := s.heard
+	if old, ok := all[relpath]; ok && !old.played() && old.Tracks == len(s.tracks) {
+		for _, i := range old.Heard {
+			heard[i] = true
+		}
+	}
+
+	p := albumProgress{
+		Tracks:  len(s.tracks),
+		Heard:   []int{},
+		Stopped: s.current,
+		Time:    time.Now(),
+	}
+	for i := range heard {
+		p.Heard = append(p.Heard, i)
+	}
+	slices.Sort(p.Heard)
+	all[relpath] = p
+	log.Println("progress:", relpath, p)
+
+	b, _ := json.Marshal(all)
+	if err := os.WriteFile(progressPath(), b, 0644); err != nil {
+		log.Println("could not write progress:", err)
+	}
+}
+
+// Whether the album should be removed from the queue after playback (which
+// started at start), according to the dequeue policy:
+//
+//	always: regardless of progress (default)
+//	heard:  if at least one track was heard
+//	played: only if every track was heard
+//
+// If the backend did not report any progress, the album is always removed.
+func shouldDequeue(relpath string, start time.Time) bool {
+	p, ok := readProgress()[relpath]
+	if !ok || p.Time.Before(start) {
+		return true
+	}
+	switch config.Playback.Dequeue {
+	case "heard":
+		return len(p.Heard) > 0
+	case "played":
+		return p.played()
+	default:
+		return true
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgress(t *testing.T) {
+	state, dq := config.StateDir, config.Playback.Dequeue
+	defer func() { config.StateDir, config.Playback.Dequeue = state, dq }()
+	config.StateDir = t.TempDir()
+
+	path := filepath.Join(config.Library.Root, "a/b")
+	start := time.Now()
+
+	// stopped during the 2nd track
+	s := newListenSession(make([]string, 3))
+	s.play(0)
+	s.finish()
+	s.play(1)
+	s.record(path)
+	assert.Equal(t, readProgress()["a/b"].String(), "abandoned at 2/3")
+
+	config.Playback.Dequeue = "played"
+	assert.False(t, shouldDequeue("a/b", start))
+	config.Playback.Dequeue = "heard"
+	assert.True(t, shouldDequeue("a/b", start))
+	// no progress reported
+	assert.True(t, shouldDequeue("a/c", start))
+	assert.True(t, shouldDequeue("a/b", time.Now()))
+
+	// resumed; progress is merged
+	s = newListenSession(make([]string, 3))
+	s.play(1)
+	s.finish()
+	s.play(2)
+	s.finish()
+	s.record(path)
+	assert.Equal(t, readProgress()["a/b"].String(), "played")
+
+	// fully played albums start afresh
+	s = newListenSession(make([]string, 3))
+	s.play(2)
+	s.finish()
+	s.record(path)
+	assert.Equal(t, readProgress()["a/b"].String(), "partial 1/3")
+
+	assert.False(t, albumProgress{Stopped: -1}.played())
+}
@@ -0,0 +1,369 @@
+// Management of mpv's watch_later entries. When mpv is quit with the
+// `quit_watch_later` command, a file is written to the watch_later dir,
+// containing (among other things) the full path to the file, and the position
+// at which playback will resume:
+//
+//	# /path/to/artist/album/01 track.flac
+//	start=123.456000
+//
+// Any album with an entry is considered resumable.
+//
+// Files are named by the MD5 of the path that was played, so checking whether
+// a given album is resumable does not require reading the dir. Going the other
+// way (file -> album) requires reading the first line, which may not even
+// exist (if mpv is configured without write-filename-in-watch-later-config);
+// resolved mappings are thus cached in the state dir.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type resumeEntry struct {
+	file    string    // watch_later file
+	path    string    // fullpath of media file; empty if unknown
+	relpath string    // album (depth 2); empty if not in library
+	start   float64   // seconds
+	saved   time.Time // mtime of file
+}
+
+// Returns the album (relpath of depth 2) containing a fullpath. Returns empty
+// string if path is not under root.
+func albumOf(path string) string {
+	rel, err := filepath.Rel(config.Library.Root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	parts := strings.SplitN(rel, string(filepath.Separator), 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return filepath.Join(parts[0], parts[1])
+}
+
+func parseWatchLater(file string) (resumeEntry, error) {
+	e := resumeEntry{file: file}
+	fo, err := os.Open(file)
+	if err != nil {
+		return e, err
+	}
+	defer fo.Close()
+
+	if fi, err := fo.Stat(); err == nil {
+		e.saved = fi.ModTime()
+	}
+
+	sc := bufio.NewScanner(fo)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "# ") && e.path == "":
+			e.path = line[2:]
+		case strings.HasPrefix(line, "start="):
+			e.start, _ = strconv.ParseFloat(line[6:], 64)
+		}
+	}
+	if e.path != "" {
+		e.relpath = albumOf(e.path)
+	}
+	return e, sc.Err()
+}
+
+// mpv names watch_later files by the (uppercase hex) MD5 of the path that was
+// played
+func watchLaterName(path string) string {
+	sum := md5.Sum([]byte(path))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func watchLaterNames() []string {
+	if config == nil {
+		panic("init was not done")
+	}
+
+	files, err := os.ReadDir(config.Mpv.WatchLaterDir)
+	if err != nil {
+		log.Println("no watch_later dir:", err)
+		return nil
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() {
+			names = append(names, f.Name())
+		}
+	}
+	return names
+}
+
+func resumeIndexPath() string { return statePath("resume-index.json") }
+
+// Cached results of resumeIndex
+type resumeCache struct {
+	Paths map[string]string `json:"paths"`
+	// unresolvable files, by mtime; these are only looked for in full
+	// again if they change
+	Unresolved map[string]time.Time `json:"unresolved"`
+	Checked    time.Time            `json:"checked"` // when last looked for
+}
+
+// Returns a map of watch_later filenames to the fullpaths they refer to. Paths
+// that cannot be determined map to empty string.
+//
+// Only files not yet in the cache are read. For files without a filename, the
+// path is found by hashing the tracks of recently played albums (and, failing
+// that, queued albums). Unresolvable files are only looked for among albums
+// played since, so this is only expensive once per file.
+func resumeIndex() map[string]string {
+	checked := time.Now()
+	old, _ := os.ReadFile(resumeIndexPath())
+	var cache resumeCache
+	_ = json.Unmarshal(old, &cache)
+
+	idx := make(map[string]string)
+	mtimes := make(map[string]time.Time)
+	unnamed := make(map[string]any)
+	retry := make(map[string]any)
+	for _, name := range watchLaterNames() {
+		if p, ok := cache.Paths[name]; ok {
+			idx[name] = p
+			continue
+		}
+		path := filepath.Join(config.Mpv.WatchLaterDir, name)
+		if fi, err := os.Stat(path); err == nil {
+			mtimes[name] = fi.ModTime()
+		}
+		if mt, ok := cache.Unresolved[name]; ok && mt.Equal(mtimes[name]) {
+			retry[name] = nil
+			idx[name] = ""
+			continue
+		}
+		e, err := parseWatchLater(path)
+		if err != nil {
+			log.Println("invalid watch_later file:", name, err)
+			continue
+		}
+		if e.path == "" {
+			unnamed[name] = nil
+		}
+		idx[name] = e.path
+	}
+
+	looked := len(unnamed) > 0
+	if looked {
+		resolveUnnamed(unnamed, idx, resumeCandidates(time.Time{}))
+	}
+	if len(retry) > 0 {
+		if candidates := resumeCandidates(cache.Checked); len(candidates) > 0 {
+			resolveUnnamed(retry, idx, candidates)
+			looked = true
+		}
+	}
+	if !looked {
+		checked = cache.Checked
+	}
+
+	// stale cache entries are dropped, since idx only contains existing
+	// files
+	cache = resumeCache{
+		Paths:      make(map[string]string),
+		Unresolved: make(map[string]time.Time),
+		Checked:    checked,
+	}
+	for name, p := range idx {
+		if p == "" {
+			cache.Unresolved[name] = mtimes[name]
+		} else {
+			cache.Paths[name] = p
+		}
+	}
+	if b, _ := json.Marshal(cache); !bytes.Equal(b, old) {
+		if err := os.WriteFile(resumeIndexPath(), b, 0644); err != nil {
+			log.Println("could not write resume index:", err)
+		}
+	}
+	return idx
+}
+
+// Albums whose tracks may have watch_later files: those played since the given
+// time (most recent first), or if zero, the entire history and queue
+func resumeCandidates(since time.Time) []string {
+	var candidates []string
+	history, _ := readHistory()
+	for _, h := range slices.Backward(history) {
+		if h.End.After(since) {
+			candidates = append(candidates, h.Relpath)
+		}
+	}
+	if since.IsZero() {
+		candidates = append(candidates, getQueue(0)...)
+	}
+	return candidates
+}
+
+func resolveUnnamed(unnamed map[string]any, idx map[string]string, candidates []string) {
+	defer timer("resolve unnamed resumes")()
+
+	seen := make(map[string]any)
+	for _, rel := range candidates {
+		if _, ok := seen[rel]; ok {
+			continue
+		}
+		seen[rel] = nil
+
+		tracks, _ := albumTracks(filepath.Join(config.Library.Root, rel))
+		for _, t := range tracks {
+			h := watchLaterName(t)
+			if _, ok := unnamed[h]; ok {
+				idx[h] = t
+				delete(unnamed, h)
+			}
+		}
+		if len(unnamed) == 0 {
+			return
+		}
+	}
+	log.Println("unresolvable resumes:", len(unnamed))
+}
+
+// All watch_later entries. Paths that are missing from the file are filled in
+// from the index.
+func readResumeEntries() []resumeEntry {
+	idx := resumeIndex()
+	var entries []resumeEntry
+	for _, name := range watchLaterNames() {
+		e, err := parseWatchLater(filepath.Join(config.Mpv.WatchLaterDir, name))
+		if err != nil {
+			log.Println("invalid watch_later file:", name, err)
+			continue
+		}
+		if e.path == "" && idx[name] != "" {
+			e.path = idx[name]
+			e.relpath = albumOf(e.path)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// Only entries pointing to files that (still) exist in the library. Entries
+// for directories (which mpv writes as redirects) are ignored.
+func (e resumeEntry) valid() bool {
+	if e.relpath == "" {
+		return false
+	}
+	fi, err := os.Stat(e.path)
+	return err == nil && !fi.IsDir()
+}
+
+// Relpaths of resumable albums, sorted
+func getResumes() []string {
+	var resumes []string
+	for _, path := range resumeIndex() {
+		e := resumeEntry{path: path, relpath: albumOf(path)}
+		if e.valid() && !slices.Contains(resumes, e.relpath) {
+			resumes = append(resumes, e.relpath)
+		}
+	}
+	slices.Sort(resumes)
+	return resumes
+}
+
+// Returns the watch_later files (which may not exist) of every track in an
+// album
+func albumWatchLaterFiles(relpath string) []string {
+	tracks, _ := albumTracks(filepath.Join(config.Library.Root, relpath))
+	files := make([]string, len(tracks))
+	for i, t := range tracks {
+		files[i] = filepath.Join(config.Mpv.WatchLaterDir, watchLaterName(t))
+	}
+	return files
+}
+
+func willResume(relpath string) bool {
+	for _, f := range albumWatchLaterFiles(relpath) {
+		if _, err := os.Stat(f); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove all watch_later entries of an album
+func discardResumes(relpath string) error {
+	for _, f := range albumWatchLaterFiles(relpath) {
+		err := os.Remove(f)
+		switch {
+		case err == nil:
+			log.Println("discarded resume:", f)
+		case !errors.Is(err, fs.ErrNotExist):
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove watch_later entries whose file no longer exists (e.g. because the
+// album was deleted or moved). Entries without a filename, and entries outside
+// the library are left alone. Returns the number of entries removed.
+func cleanResumes() (int, error) {
+	var n int
+	for _, e := range readResumeEntries() {
+		if e.path == "" || e.relpath == "" {
+			continue
+		}
+		if _, err := os.Stat(e.path); err == nil {
+			continue
+		}
+		if err := os.Remove(e.file); err != nil {
+			return n, err
+		}
+		log.Println("removed stale resume:", e.file, e.path)
+		n++
+	}
+	return n, nil
+}
+
+// Items are resumable albums; each preview lists the file and position that
+// playback will resume at.
+func resumeBrowser() *Browser {
+	previews := make(map[string][]string)
+	var items []string
+	for _, e := range readResumeEntries() {
+		if !e.valid() {
+			continue
+		}
+		if _, ok := previews[e.relpath]; !ok {
+			items = append(items, e.relpath)
+		}
+		rel, _ := filepath.Rel(filepath.Join(config.Library.Root, e.relpath), e.path)
+		previews[e.relpath] = append(previews[e.relpath],
+			rel,
+			fmt.Sprintf(
+				"  start=%s, saved %s",
+				fmtDuration(time.Duration(e.start*float64(time.Second))),
+				e.saved.Format(time.DateTime),
+			),
+		)
+	}
+	slices.Sort(items)
+
+	b := newBrowser(items, Resumes)
+	b.previews = previews
+	b.noquit = true
+	return b
+}
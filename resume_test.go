@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResumes(t *testing.T) {
+	root, wl, state, queue := config.Library.Root, config.Mpv.WatchLaterDir, config.StateDir, config.Library.Queue
+	defer func() {
+		config.Library.Root, config.Mpv.WatchLaterDir, config.StateDir, config.Library.Queue = root, wl, state, queue
+	}()
+	config.Library.Root = t.TempDir()
+	config.Library.Queue = filepath.Join(t.TempDir(), "queue")
+	_ = os.WriteFile(config.Library.Queue, nil, 0644)
+	config.Mpv.WatchLaterDir = t.TempDir()
+	config.StateDir = t.TempDir()
+
+	track := filepath.Join(config.Library.Root, "a", "b", "CD2", "01.flac")
+	unnamed := filepath.Join(config.Library.Root, "e", "f", "01.mp3")
+	for _, f := range []string{track, unnamed} {
+		_ = os.MkdirAll(filepath.Dir(f), 0755)
+		_ = os.WriteFile(f, nil, 0644)
+	}
+	deleted := filepath.Join(config.Library.Root, "c", "d", "01.flac")
+	redirect := filepath.Join(config.Library.Root, "a", "b")
+
+	for name, content := range map[string]string{
+		watchLaterName(track):    "# " + track + "\nstart=205.500000\n",
+		watchLaterName(deleted):  "# " + deleted + "\nstart=1\n",
+		watchLaterName(redirect): "# " + redirect + "\n",
+		watchLaterName(unnamed):  "start=1\n", // no filename
+		"foo":                    "",          // garbage
+	} {
+		_ = os.WriteFile(filepath.Join(config.Mpv.WatchLaterDir, name), []byte(content), 0644)
+	}
+
+	e, err := parseWatchLater(filepath.Join(config.Mpv.WatchLaterDir, watchLaterName(track)))
+	assert.Nil(t, err)
+	assert.Equal(t, e.relpath, "a/b")
+	assert.Equal(t, e.start, 205.5)
+
+	// unnamed entry is not in the history yet
+	assert.Equal(t, getResumes(), []string{"a/b"})
+	var cache resumeCache
+	b, _ := os.ReadFile(resumeIndexPath())
+	assert.Nil(t, json.Unmarshal(b, &cache))
+	assert.Contains(t, cache.Unresolved, watchLaterName(unnamed))
+	// the queue is not searched again
+	_ = os.WriteFile(config.Library.Queue, []byte("e/f\n"), 0644)
+	assert.Equal(t, getResumes(), []string{"a/b"})
+	// resolved via history, once the album is played
+	recordHistory("e/f", 0, e.saved, "resume")
+	assert.Equal(t, getResumes(), []string{"a/b", "e/f"})
+	assert.Equal(t, resumeIndex()[watchLaterName(unnamed)], unnamed)
+
+	assert.True(t, willResume("a/b"))
+	assert.True(t, willResume("e/f"))
+	assert.False(t, willResume("c/d"))
+
+	n, err := cleanResumes()
+	assert.Nil(t, err)
+	assert.Equal(t, n, 1)
+	assert.Len(t, readResumeEntries(), 4)
+
+	assert.Nil(t, discardResumes("a/b"))
+	assert.False(t, willResume("a/b"))
+	assert.Len(t, readResumeEntries(), 3)
+}
@@ -0,0 +1,63 @@
+// Sampling strategies. A sampler determines the order in which queued items
+// are offered to the user; callers typically just take the first n items.
+
+package main
+
+import (
+	"cmp"
+	"log"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// Returns a ranked copy of relpaths. The input slice must not be modified.
+type sampler func(relpaths []string) []string
+
+var samplers = map[string]sampler{
+	"random": func(relpaths []string) []string {
+		ranked := make([]string, len(relpaths))
+		for i, r := range rand.Perm(len(relpaths)) {
+			ranked[i] = relpaths[r]
+		}
+		return ranked
+	},
+
+	// order of the queue file. note that this is not quite FIFO, as
+	// `remove` does not preserve order
+	"sequential": slices.Clone[[]string],
+
+	// random, but weighted by rating (Discogs, or local), so that a ★5
+	// album is 5 times as likely as a ★1 album to come first. unrated
+	// albums are weighted as ★3
+	"rating": func(relpaths []string) []string {
+		return weightedSample(relpaths, albumRatings())
+	},
+}
+
+const unratedWeight = 3
+
+// Weighted random permutation (Efraimidis-Spirakis): each item gets the key
+// u^(1/w), and items are sorted by descending key
+func weightedSample(relpaths []string, ratings map[string]int) []string {
+	keys := make(map[string]float64, len(relpaths))
+	for _, r := range relpaths {
+		w, ok := ratings[r]
+		if !ok || w < 1 {
+			w = unratedWeight
+		}
+		keys[r] = math.Pow(rand.Float64(), 1/float64(w))
+	}
+	ranked := slices.Clone(relpaths)
+	slices.SortFunc(ranked, func(a, b string) int { return cmp.Compare(keys[b], keys[a]) })
+	return ranked
+}
+
+func activeSampler() sampler {
+	s, ok := samplers[config.Sampler]
+	if !ok {
+		log.Println("invalid sampler, using random:", config.Sampler)
+		return samplers["random"]
+	}
+	return s
+}
@@ -0,0 +1,456 @@
+// Post-playback steps. After playback (that will not be resumed), the steps
+// listed in playback.steps are run in order, e.g.
+//
+//	[playback]
+//	steps = ["dequeue", "rate-local", "notes"]
+//
+// All steps share a single postPlayback, which earlier steps may fill in for
+// later ones (e.g. the delete step only acts on a rating of 1). A step may
+// stop the pipeline by returning errStopSteps; any other error is logged, and
+// also stops the pipeline.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"plaque/discogs"
+)
+
+var defaultSteps = []string{"dequeue", "rate", "delete", "browse"}
+
+var steps = map[string]func(*postPlayback) error{
+	"dequeue":    dequeueStep,
+	"rate":       rateStep,
+	"rate-local": rateLocalStep,
+	"delete":     deleteStep,
+	"browse":     browseStep,
+	"notes":      notesStep,
+}
+
+var errStopSteps = errors.New("stop")
+
+type postPlayback struct {
+	relpath string
+	start   time.Time
+	rating  int  // 0 if not rated (yet)
+	offline bool // discogs was found to be unreachable
+}
+
+// Album, without the " (YYYY)" suffix
+func (p *postPlayback) album() string {
+	_, album := filepath.Split(p.relpath)
+	return yearSuffix.ReplaceAllString(album, "")
+}
+
+// Aside from edge cases, only classical albums have " [performer, ...]" suffix
+func (p *postPlayback) classical() bool { return strings.HasSuffix(p.album(), "]") }
+
+// Artist and album, as suitable for a Discogs search
+func (p *postPlayback) searchTerms() (string, string) {
+	artist := filepath.Dir(p.relpath)
+
+	// remove possible " (translation)"; a trailing ")" alone (e.g. "Sunn
+	// O)))") is part of the name
+	if i := strings.LastIndex(artist, " ("); i > 0 && strings.HasSuffix(artist, ")") {
+		artist = artist[:i]
+	}
+
+	if p.classical() {
+		return movePerfsToArtist(artist, p.album())
+	}
+	return artist, p.album()
+}
+
+// From the " (YYYY)" suffix; 0 if absent
+func (p *postPlayback) year() int {
+	if !yearSuffix.MatchString(p.relpath) {
+		return 0
+	}
+	y, _ := strconv.Atoi(p.relpath[len(p.relpath)-5 : len(p.relpath)-1])
+	return y
+}
+
+// What is known about the album locally, for matching against Discogs
+func (p *postPlayback) local() discogs.Local {
+	artist, album := p.searchTerms()
+	l := discogs.Local{Artist: artist, Title: album, Year: p.year()}
+	if tracks, err := albumTracks(filepath.Join(config.Library.Root, p.relpath)); err == nil {
+		l.Tracks = len(tracks)
+	}
+	l.Duration, _ = albumDuration(p.relpath)
+	return l
+}
+
+// Record a rating of rel (nil if only rated locally) in the mirror, and run
+// the rating hooks
+func (p *postPlayback) rated(vars hookVars, rel *discogs.Release, rating int) error {
+	if rel != nil {
+		if err := mirrorRated(rel, rating); err != nil {
+			log.Println(err)
+		}
+	}
+	vars.Rating = rating
+	emit(Rated, vars, "")
+	if err := runHook(OnRate, vars); err != nil {
+		return errStopSteps
+	}
+	return nil
+}
+
+// Discogs errors are not fatal to the pipeline; later steps may still be
+// useful (e.g. dequeue)
+func (p *postPlayback) discogsFailed(err error) error {
+	switch {
+	case err == nil,
+		errors.Is(err, discogs.ErrNotFound),
+		errors.Is(err, discogs.ErrNotRated),
+		errors.Is(err, discogs.ErrNotRateable),
+		errors.Is(err, discogs.ErrAlreadyRated):
+		log.Println("not rated:", p.relpath, err)
+	default:
+		fmt.Println("Discogs unavailable:", err)
+		log.Println("discogs failed:", err)
+		p.offline = true
+	}
+	return nil
+}
+
+func runSteps(p *postPlayback) {
+	names := config.Playback.Steps
+	if names == nil {
+		names = defaultSteps
+	}
+	for _, name := range names {
+		err := steps[name](p)
+		switch {
+		case errors.Is(err, errStopSteps):
+			log.Println("steps stopped at:", name)
+			return
+		case err != nil:
+			log.Println("step failed:", name, err)
+			return
+		}
+	}
+}
+
+// Albums played from focus mode (in Albums mode) may not be queued
+func dequeueStep(p *postPlayback) error {
+	q := getQueue(0)
+	if !slices.Contains(q, p.relpath) {
+		log.Println("not queued:", p.relpath)
+		return nil
+	}
+	if !shouldDequeue(p.relpath, p.start) {
+		log.Println("not fully played, keeping in queue:", p.relpath)
+		return nil
+	}
+	nq := *remove(&q, p.relpath)
+	ensure(len(q)-len(nq) == 1)
+	writeQueue(nq)
+	log.Println("removed:", p.relpath)
+	emit(Dequeued, newHookVars(p.relpath), "")
+	return nil
+}
+
+func rateStep(p *postPlayback) error {
+	if !discogsEnabled {
+		log.Println("no discogs key, skipping rate")
+		return nil
+	}
+
+	wrong := make(map[int]bool) // ids rejected so far
+	for {
+		rel, err := p.release(wrong)
+		if err != nil {
+			return p.discogsFailed(err)
+		}
+		if rel == nil {
+			log.Println("no match chosen:", p.relpath)
+			return nil
+		}
+
+		rating, err := rel.Rate(discogs.WrongMatch, discogs.Delete)
+		switch {
+		case errors.Is(err, discogs.ErrWrongMatch):
+			log.Println("wrong match:", p.relpath, rel.Id)
+			if err := mapAlbum(p.relpath, mappedRelease{}); err != nil {
+				log.Println("could not clear mapping:", err)
+			}
+			wrong[rel.Id] = true
+			continue
+		case errors.Is(err, discogs.ErrDelete):
+			promptDelete(p.relpath, !p.classical())
+			return errStopSteps
+		case rating == 0:
+			return p.discogsFailed(err)
+		}
+		p.rating = rating
+		return p.rated(newHookVars(p.relpath), rel, rating)
+	}
+}
+
+// The release of the album, either from the mapping, or by matching (in which
+// case the mapping is updated). Returns nil if the user declined all matches.
+//
+// If any releases were found to be wrong (i.e. their ids are in wrong), the
+// mapping is ignored, the wrong releases are excluded, and the user always
+// chooses.
+func (p *postPlayback) release(wrong map[int]bool) (*discogs.Release, error) {
+	if mapped, ok := readMapping().Albums[p.relpath]; ok && len(wrong) == 0 {
+		rel, err := mapped.get()
+		if errors.Is(err, discogs.ErrNetwork) && !mapped.Master && discogs.Default.Outbox != nil {
+			// not cached, but the id is enough to queue a rating
+			artist, album := p.searchTerms()
+			return &discogs.Release{Id: mapped.Id, Title: album, ArtistsSort: artist, Year: p.year()}, nil
+		}
+		return &rel, err
+	}
+
+	matches, err := discogs.Matches(p.local())
+	if err != nil {
+		return nil, err
+	}
+	matches = slices.DeleteFunc(matches, func(m discogs.Match) bool { return wrong[m.Release.Id] })
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	m := matches[0]
+	if !m.Confident() || len(wrong) > 0 {
+		var ok bool
+		if m, ok = chooseMatch(p.relpath, matches); !ok {
+			return nil, nil
+		}
+	}
+	if err := mapAlbum(p.relpath, releaseMapping(m.Release)); err != nil {
+		log.Println("could not save mapping:", err)
+	}
+	return &m.Release, nil
+}
+
+// Rather than rate the wrong release, let the user pick one (or none) of the
+// candidates
+func chooseMatch(relpath string, matches []discogs.Match) (discogs.Match, bool) {
+	fmt.Println("Uncertain match for", relpath)
+	for i, m := range matches {
+		fmt.Printf("%d. %s\n   %s\n", i+1, m, m.Release.URL())
+	}
+	fmt.Printf("choose (1-%d, empty to skip): ", len(matches))
+	var s string
+	_, _ = fmt.Scanln(&s)
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 1 || i > len(matches) {
+		return discogs.Match{}, false
+	}
+	return matches[i-1], true
+}
+
+func localRatingsPath() string { return statePath("ratings.json") }
+
+// Ratings that are only kept locally, keyed by relpath
+func readLocalRatings() map[string]int {
+	ratings := make(map[string]int)
+	if b, err := os.ReadFile(localRatingsPath()); err == nil {
+		_ = json.Unmarshal(b, &ratings)
+	}
+	return ratings
+}
+
+func rateLocalStep(p *postPlayback) error {
+	fmt.Println(p.relpath)
+	fmt.Print("rating (1-5, empty to skip): ")
+	var s string
+	_, _ = fmt.Scanln(&s)
+	rating, err := strconv.Atoi(s)
+	if err != nil || rating < 1 || rating > 5 {
+		return nil
+	}
+
+	ratings := readLocalRatings()
+	ratings[p.relpath] = rating
+	b, _ := json.Marshal(ratings)
+	if err := os.WriteFile(localRatingsPath(), b, 0644); err != nil {
+		return err
+	}
+	p.rating = rating
+	return p.rated(newHookVars(p.relpath), nil, rating)
+}
+
+// Only offered on a rating of 1. Artist deletion is not offered for classical
+// albums, as a guard rail.
+func deleteStep(p *postPlayback) error {
+	if p.rating == 1 {
+		promptDelete(p.relpath, !p.classical())
+	}
+	return nil
+}
+
+// Number of files in a dir (recursively), and their total size
+func dirSummary(path string) string {
+	var n int
+	var size int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if fi, err := d.Info(); err == nil {
+			n++
+			size += fi.Size()
+		}
+		return nil
+	})
+	return fmt.Sprintf("%d files, %.1f MiB", n, float64(size)/(1<<20))
+}
+
+// Offer to trash the album, or the entire artist (if allowed), after listing
+// exactly what would be removed
+func promptDelete(relpath string, allowArtist bool) {
+	album := filepath.Join(config.Library.Root, relpath)
+	artist := filepath.Dir(album)
+	if _, err := os.Stat(album); err != nil {
+		return
+	}
+
+	fmt.Printf("Album: %s (%s)\n", album, dirSummary(album))
+	_ = filepath.WalkDir(album, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(album, path)
+			fmt.Println("  " + rel)
+		}
+		return nil
+	})
+	choices := "[a]lbum"
+	if allowArtist {
+		fmt.Printf("Artist: %s (%s)\n", artist, dirSummary(artist))
+		albums, _ := descend(artist)
+		for _, a := range albums {
+			fmt.Printf("  %s (%s)\n", a, dirSummary(filepath.Join(artist, a)))
+		}
+		choices += "/a[r]tist"
+	}
+
+	fmt.Printf("Move to trash? %s/[N]one ", choices)
+	var del string
+	_, _ = fmt.Scanln(&del)
+
+	var p string
+	var vars hookVars
+	switch {
+	case del == "a":
+		p, vars = album, newHookVars(relpath)
+	case del == "r" && allowArtist:
+		p, vars = artist, hookVars{Artist: filepath.Base(artist), Path: artist}
+	default:
+		return
+	}
+
+	if err := runHook(OnDelete, vars); err != nil {
+		return
+	}
+	name, err := trash(p)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	emit(Deleted, vars, "")
+	fmt.Printf("Trashed %s (undo: plaque trash restore %s)\n", p, name)
+}
+
+// Browse the artist's releases, and rate the first that is not in the
+// library. Skipped on a rating of 1.
+func browseStep(p *postPlayback) error {
+	if !discogsEnabled || p.offline || p.rating == 1 {
+		return nil
+	}
+
+	artist, _ := filepath.Split(p.relpath)
+	artist = strings.TrimSuffix(artist, "/")
+
+	var art *discogs.Artist
+	if id, ok := readMapping().Artists[artist]; ok {
+		art = &discogs.Artist{Id: id}
+	} else {
+		// this is not terribly ergonomic; but wrapping the returned
+		// []Artist in a struct seems even more annoying
+		artists, err := discogs.SearchArtist(artist)
+		if err != nil || len(artists) == 0 {
+			return p.discogsFailed(err)
+		}
+
+		art = discogs.BrowseArtists(artists)
+		if art == nil {
+			return nil
+		}
+		if err := mapArtist(artist, art.Id); err != nil {
+			log.Println("could not save mapping:", err)
+		}
+	}
+
+	// art.Rate(checkDir) // nonsensical api
+	// art.Rate() // sane api, but no checkDir
+
+	// pages are only fetched until a rateable release is found
+	for rel, err := range art.IterReleases() {
+		if err != nil {
+			return p.discogsFailed(err)
+		}
+		// if !rel.IsRateable() || checkDir(artist, rel.Title) {
+		// 	continue
+		// }
+		if checkDir(artist, rel.Title) {
+			continue
+		}
+
+		rating, err := rel.Rate(discogs.WrongMatch)
+		switch {
+		case errors.Is(err, discogs.ErrAlreadyRated), errors.Is(err, discogs.ErrNotRateable):
+			continue
+		case errors.Is(err, discogs.ErrWrongMatch): // i.e. wrong artist
+			log.Println("wrong artist:", artist, art.Id)
+			if err := mapArtist(artist, 0); err != nil {
+				log.Println("could not clear mapping:", err)
+			}
+			return nil
+		case rating == 0:
+			return p.discogsFailed(err)
+		}
+		return p.rated(hookVars{Artist: artist, Album: rel.Title}, &rel, rating)
+	}
+	return nil
+}
+
+func notesPath() string { return statePath("notes.jsonl") }
+
+// Prompt for a free-form note, which is appended to notes.jsonl
+func notesStep(p *postPlayback) error {
+	fmt.Print("notes (empty to skip): ")
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+
+	b, _ := json.Marshal(map[string]any{
+		"time":    time.Now(),
+		"relpath": p.relpath,
+		"note":    line,
+	})
+	f, err := os.OpenFile(notesPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
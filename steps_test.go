@@ -0,0 +1,184 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"plaque/discogs"
+	"plaque/discogs/discogstest"
+)
+
+func TestSteps(t *testing.T) {
+	s := config.Playback.Steps
+	defer func() { config.Playback.Steps = s }()
+
+	var ran []string
+	steps["a"] = func(p *postPlayback) error {
+		ran = append(ran, "a")
+		p.rating = 3
+		return nil
+	}
+	steps["b"] = func(p *postPlayback) error {
+		ran = append(ran, "b")
+		return errStopSteps
+	}
+	defer delete(steps, "a")
+	defer delete(steps, "b")
+
+	config.Playback.Steps = []string{"b", "a"}
+	runSteps(&postPlayback{})
+	assert.Equal(t, ran, []string{"b"})
+
+	ran = nil
+	config.Playback.Steps = []string{"a", "b", "a"}
+	runSteps(&postPlayback{})
+	assert.Equal(t, ran, []string{"a", "b"})
+	p := postPlayback{}
+	config.Playback.Steps = []string{"a"}
+	runSteps(&p)
+	assert.Equal(t, p.rating, 3)
+
+	p = postPlayback{relpath: "Artist (Translation)/Sonatas [Perf] (1999)"}
+	assert.True(t, p.classical())
+	artist, album := p.searchTerms()
+	assert.Equal(t, artist, "Artist Perf")
+	assert.Equal(t, album, "Sonatas")
+	assert.Equal(t, p.year(), 1999)
+	p.relpath = "Artist/Album (Live)"
+	assert.Equal(t, p.year(), 0)
+	assert.Equal(t, p.album(), "Album (Live)")
+
+	// names that end in ")" without a year or translation
+	for relpath, want := range map[string][2]string{
+		"Sunn O)))/Monoliths & Dimensions (2009)": {"Sunn O)))", "Monoliths & Dimensions"},
+		"Sunn O)))/Kannon":                        {"Sunn O)))", "Kannon"},
+		"X/(a)":                                   {"X", "(a)"},
+		"Y (Z)/)":                                 {"Y", ")"},
+		"X/[Untitled]":                            {"X", "[Untitled]"},
+	} {
+		p.relpath = relpath
+		artist, album := p.searchTerms()
+		assert.Equal(t, [2]string{artist, album}, want)
+	}
+	p.relpath = "X/(a)"
+	assert.Equal(t, p.year(), 0)
+}
+
+func TestDequeueStep(t *testing.T) {
+	queue, state := config.Library.Queue, config.StateDir
+	defer func() { config.Library.Queue, config.StateDir = queue, state }()
+	config.Library.Queue = filepath.Join(t.TempDir(), "queue")
+	config.StateDir = t.TempDir()
+	writeQueue([]string{"a/b", "c/d"})
+
+	// e.g. played from focus mode in Albums mode
+	assert.Nil(t, dequeueStep(&postPlayback{relpath: "e/f"}))
+	assert.Equal(t, getQueue(0), []string{"a/b", "c/d"})
+
+	assert.Nil(t, dequeueStep(&postPlayback{relpath: "a/b"}))
+	assert.Equal(t, getQueue(0), []string{"c/d"})
+}
+
+// The rating flow, against recorded Discogs responses
+func TestRateStep(t *testing.T) {
+	d, enabled, stdin, state := discogs.Default, discogsEnabled, os.Stdin, config.StateDir
+	defer func() { discogs.Default, discogsEnabled, os.Stdin, config.StateDir = d, enabled, stdin, state }()
+	discogsEnabled = true
+	config.StateDir = t.TempDir()
+
+	// only for choosing matches
+	r, w, _ := os.Pipe()
+	os.Stdin = r
+
+	// answers to the rating prompt, in order
+	type answer struct {
+		rating int
+		err    error
+	}
+	var answers []answer
+	prompt := func(*discogs.Release, []discogs.Action) (int, error) {
+		a := answers[0]
+		answers = answers[1:]
+		return a.rating, a.err
+	}
+
+	discogs.Default = discogstest.NewClient(t, "discogs/testdata")
+	discogs.Default.Prompt = prompt
+	answers = []answer{{rating: 4}}
+	p := postPlayback{relpath: "Metallica/Ride the Lightning (1984)"}
+	assert.Nil(t, rateStep(&p))
+	assert.Equal(t, p.rating, 4)
+	assert.False(t, p.offline)
+	assert.Equal(t, readMapping().Albums[p.relpath], mappedRelease{Id: 6440, Master: true})
+
+	// uncertain matches are only rated (and mapped) if chosen
+	threshold := discogs.MatchThreshold
+	defer func() { discogs.MatchThreshold = threshold }()
+	discogs.MatchThreshold = 1.1
+	_, _ = w.WriteString("\n")
+	p = postPlayback{relpath: "Metallica/Ride the Lightning"}
+	assert.Nil(t, rateStep(&p))
+	assert.Equal(t, p.rating, 0)
+	assert.Len(t, readMapping().Albums, 1)
+	_, _ = w.WriteString("1\n")
+	answers = []answer{{rating: 5}}
+	assert.Nil(t, rateStep(&p))
+	assert.Equal(t, p.rating, 5)
+	assert.Len(t, readMapping().Albums, 2)
+
+	// mapped albums are not matched again
+	answers = []answer{{rating: 3}}
+	p = postPlayback{relpath: "Metallica/Ride the Lightning (1984)"}
+	assert.Nil(t, rateStep(&p))
+	assert.Equal(t, p.rating, 3)
+	discogs.MatchThreshold = threshold
+
+	// skipped
+	answers = []answer{{err: discogs.ErrNotRated}}
+	p = postPlayback{relpath: "Metallica/Ride the Lightning (1984)"}
+	assert.Nil(t, rateStep(&p))
+	assert.Equal(t, p.rating, 0)
+
+	// a wrong match is forgotten, and is not offered again (leaving
+	// nothing to choose from)
+	answers = []answer{{err: discogs.ErrWrongMatch}}
+	assert.Nil(t, rateStep(&p))
+	assert.Equal(t, p.rating, 0)
+	assert.Len(t, readMapping().Albums, 1)
+	assert.Empty(t, answers)
+
+	// all releases rejected so far are excluded
+	rel, err := p.release(map[int]bool{6440: true, 1: true})
+	assert.Nil(t, err)
+	assert.Nil(t, rel)
+
+	// delete stops the remaining steps
+	answers = []answer{{err: discogs.ErrDelete}}
+	assert.ErrorIs(t, rateStep(&p), errStopSteps)
+
+	// nothing is found; later steps can still run
+	p = postPlayback{relpath: "Metallica/Kill 'Em All (1983)"}
+	assert.Nil(t, rateStep(&p))
+	assert.Equal(t, p.rating, 0)
+
+	discogs.Default = discogs.NewClient("test", "")
+	discogs.Default.BaseURL = "http://127.0.0.1:1"
+	p = postPlayback{relpath: "Metallica/Ride the Lightning (1984)"}
+	assert.Nil(t, rateStep(&p))
+	assert.True(t, p.offline)
+
+	// with an outbox, mapped releases are rated anyway, and queued
+	discogs.Default.Outbox = discogs.NewOutbox(filepath.Join(config.StateDir, "outbox.json"))
+	discogs.Default.Prompt = prompt
+	assert.Nil(t, mapAlbum("natsumen/kill your winter (2018)", mappedRelease{Id: 12578164}))
+	answers = []answer{{rating: 2}}
+	p = postPlayback{relpath: "natsumen/kill your winter (2018)"}
+	assert.Nil(t, rateStep(&p))
+	assert.Equal(t, p.rating, 2)
+	pending, _ := discogs.Default.Outbox.Pending()
+	assert.Len(t, pending, 1)
+	assert.Equal(t, pending[0].ReleaseId, 12578164)
+}
@@ -0,0 +1,272 @@
+// Deletion via the trash. Directories are moved to an XDG-compliant trash
+// (by default, the user's home trash), alongside a .trashinfo file that
+// records the original path, so they can be restored later:
+//
+//	$XDG_DATA_HOME/Trash/files/<name>
+//	$XDG_DATA_HOME/Trash/info/<name>.trashinfo
+//
+// Any other dir can be configured as a quarantine instead (with the same
+// layout). Since the trash is a plain rename, it must be on the same
+// filesystem as the library. The trash may be shared with other programs;
+// only entries whose original path is under the library root are ever
+// listed, restored or purged.
+//
+// https://specifications.freedesktop.org/trash-spec/latest/
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const trashInfoDate = "2006-01-02T15:04:05"
+
+type trashEntry struct {
+	Name    string // under files/
+	Path    string // original fullpath
+	Deleted time.Time
+}
+
+func trashDir() string {
+	if config.Trash.Dir != "" {
+		return os.ExpandEnv(config.Trash.Dir)
+	}
+	d := os.Getenv("XDG_DATA_HOME")
+	if d == "" {
+		d = os.ExpandEnv("$HOME/.local/share")
+	}
+	return filepath.Join(d, "Trash")
+}
+
+func (e trashEntry) file() string { return filepath.Join(trashDir(), "files", e.Name) }
+
+func (e trashEntry) info() string {
+	return filepath.Join(trashDir(), "info", e.Name+".trashinfo")
+}
+
+// Move path (a fullpath) to the trash. The name under which it was trashed is
+// returned.
+func trash(path string) (string, error) {
+	for _, d := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(trashDir(), d), 0700); err != nil {
+			return "", err
+		}
+	}
+
+	// the info file is created exclusively, and thus reserves the name
+	var e trashEntry
+	var f *os.File
+	for i := 1; ; i++ {
+		e.Name = filepath.Base(path)
+		if i > 1 {
+			e.Name += "." + strconv.Itoa(i)
+		}
+		var err error
+		f, err = os.OpenFile(e.info(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+	}
+
+	_, err := fmt.Fprintf(
+		f,
+		"[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: path}).EscapedPath(),
+		time.Now().Format(trashInfoDate),
+	)
+	f.Close()
+	if err == nil {
+		err = os.Rename(path, e.file())
+	}
+	if err != nil {
+		_ = os.Remove(e.info())
+		if errors.Is(err, syscall.EXDEV) {
+			return "", fmt.Errorf("trash (%s) is not on the same filesystem as %s; set trash.dir", trashDir(), path)
+		}
+		return "", err
+	}
+	log.Println("trashed:", path, e.Name)
+	return e.Name, nil
+}
+
+func parseTrashInfo(file string) (trashEntry, error) {
+	e := trashEntry{Name: strings.TrimSuffix(filepath.Base(file), ".trashinfo")}
+	f, err := os.Open(file)
+	if err != nil {
+		return e, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, _ := strings.Cut(sc.Text(), "=")
+		switch k {
+		case "Path":
+			e.Path, err = url.PathUnescape(v)
+			if err != nil {
+				return e, err
+			}
+		case "DeletionDate":
+			e.Deleted, _ = time.ParseInLocation(trashInfoDate, v, time.Local)
+		}
+	}
+	if e.Path == "" {
+		return e, errors.New("no path: " + file)
+	}
+	return e, sc.Err()
+}
+
+// Trashed items that originated from the library, oldest first
+func trashEntries() []trashEntry {
+	files, err := os.ReadDir(filepath.Join(trashDir(), "info"))
+	if err != nil {
+		return nil
+	}
+	var entries []trashEntry
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".trashinfo") {
+			continue
+		}
+		e, err := parseTrashInfo(filepath.Join(trashDir(), "info", f.Name()))
+		if err != nil {
+			log.Println("invalid trashinfo:", err)
+			continue
+		}
+		rel, err := filepath.Rel(config.Library.Root, e.Path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b trashEntry) int {
+		if c := a.Deleted.Compare(b.Deleted); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return entries
+}
+
+// Move a trashed item back to its original path, which must not exist
+func (e trashEntry) restore() error {
+	if _, err := os.Stat(e.Path); err == nil {
+		return fmt.Errorf("already exists: %s", e.Path)
+	}
+	if err := os.MkdirAll(filepath.Dir(e.Path), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(e.file(), e.Path); err != nil {
+		return err
+	}
+	log.Println("restored:", e.Path)
+	return os.Remove(e.info())
+}
+
+func (e trashEntry) purge() error {
+	if err := os.RemoveAll(e.file()); err != nil {
+		return err
+	}
+	log.Println("purged:", e.Path)
+	return os.Remove(e.info())
+}
+
+// Permanently remove items trashed more than age ago. Returns the number of
+// items removed.
+func purgeTrash(age time.Duration) (int, error) {
+	var n int
+	for _, e := range trashEntries() {
+		if time.Since(e.Deleted) < age {
+			continue
+		}
+		if err := e.purge(); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Apply the configured purge policy, if any
+func autoPurgeTrash() {
+	if config.Trash.PurgeAfter == 0 {
+		return
+	}
+	if n, err := purgeTrash(config.Trash.PurgeAfter); err != nil {
+		log.Println("could not purge trash:", err)
+	} else if n > 0 {
+		log.Println("purged from trash:", n)
+	}
+}
+
+// plaque trash list
+// plaque trash restore [name] (default: most recently trashed)
+// plaque trash purge [-older-than duration] [-all] (default: trash.purge_after;
+// if unset, one of the flags is required)
+func trashCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: plaque trash list|restore|purge")
+	}
+
+	entries := trashEntries()
+	switch args[0] {
+	case "list":
+		for _, e := range entries {
+			fmt.Printf("%s\t%s\t%s\n", e.Deleted.Format(time.DateTime), e.Name, e.Path)
+		}
+		return nil
+
+	case "restore":
+		if len(entries) == 0 {
+			return errors.New("nothing to restore")
+		}
+		e := entries[len(entries)-1]
+		if len(args) > 1 {
+			i := slices.IndexFunc(entries, func(e trashEntry) bool { return e.Name == args[1] })
+			if i < 0 {
+				return fmt.Errorf("not in trash: %s", args[1])
+			}
+			e = entries[i]
+		}
+		if err := e.restore(); err != nil {
+			return err
+		}
+		fmt.Println("Restored", e.Path)
+		return nil
+
+	case "purge":
+		fset := flag.NewFlagSet("trash purge", flag.ContinueOnError)
+		age := fset.Duration("older-than", config.Trash.PurgeAfter, "only purge items trashed before this long ago")
+		all := fset.Bool("all", false, "purge everything")
+		if err := fset.Parse(args[1:]); err != nil {
+			return err
+		}
+		switch {
+		case *all:
+			*age = 0
+		case *age == 0: // a typo should not empty the trash
+			return errors.New("trash.purge_after is not set; use -older-than or -all")
+		}
+		n, err := purgeTrash(*age)
+		fmt.Println("Purged", n, "items")
+		return err
+
+	default:
+		return fmt.Errorf("invalid trash command: %s", args[0])
+	}
+}
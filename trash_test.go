@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrash(t *testing.T) {
+	root, tr := config.Library.Root, config.Trash
+	defer func() { config.Library.Root, config.Trash = root, tr }()
+
+	config.Library.Root = t.TempDir()
+	config.Trash.Dir = t.TempDir()
+
+	album := filepath.Join(config.Library.Root, "a b", "c%d")
+	for range 2 {
+		_ = os.MkdirAll(album, 0755)
+		_ = os.WriteFile(filepath.Join(album, "01.flac"), nil, 0644)
+		_, err := trash(album)
+		assert.Nil(t, err)
+	}
+	_, err := os.Stat(album)
+	assert.True(t, os.IsNotExist(err))
+
+	entries := trashEntries()
+	assert.Equal(t, len(entries), 2)
+	assert.Equal(t, entries[0].Name, "c%d")
+	assert.Equal(t, entries[1].Name, "c%d.2")
+	assert.Equal(t, entries[0].Path, album)
+
+	assert.Nil(t, entries[1].restore())
+	_, err = os.Stat(filepath.Join(album, "01.flac"))
+	assert.Nil(t, err)
+	assert.NotNil(t, entries[0].restore()) // already exists
+
+	n, err := purgeTrash(time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, n, 0)
+	// without purge_after, a bare purge does nothing
+	config.Trash.PurgeAfter = 0
+	assert.NotNil(t, trashCommand([]string{"purge"}))
+	assert.Len(t, trashEntries(), 1)
+	assert.Nil(t, trashCommand([]string{"purge", "-all"}))
+	assert.Empty(t, trashEntries())
+
+	// entries from outside the library are not ours
+	other := filepath.Join(t.TempDir(), "x")
+	_ = os.Mkdir(other, 0755)
+	_, _ = trash(other)
+	assert.Empty(t, trashEntries())
+}
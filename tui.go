@@ -1,11 +1,12 @@
 // TUI for basic file/directory navigation
 //
-// The Browser can exist in one of three states (Modes). Each state leverages
+// The Browser can exist in one of four states (Modes). Each state leverages
 // the same list-based TUI to present a (different) set of items to the user:
 //
 //	1. Queue: paths of depth 2, typically loaded from a (local) file
 //	2. Artists: immediate children directories of root, generated via traversal
 //	3. Albums: directories under an artist (i.e. depth 2)
+//	4. Resumes: albums with mpv watch_later entries; behaves like Queue
 //
 // The lists are implemented as a simple fzf-like menu with basic non-fuzzy
 // substring matching.
@@ -35,6 +36,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -62,15 +64,20 @@ const (
 	Queue Mode = iota
 	Artists
 	Albums
+	Resumes
 )
 
 // mostly copied from https://github.com/charmbracelet/bubbletea/tree/master/tutorials/basics
 
 type Browser struct {
-	mode     Mode
-	items    []string            // valid relpaths
-	queued   map[string]bool     // keys correspond to items
-	previews map[string][]string // keys correspond to items
+	mode      Mode
+	items     []string                 // valid relpaths
+	queued    map[string]bool          // keys correspond to items
+	previews  map[string][]string      // keys correspond to items
+	progress  map[string]albumProgress // only in Queue and Albums modes
+	resumable map[string]bool          // keys correspond to items; may be nil
+	mapping   discogsMapping           // may be zero
+	mirror    discogsMirror            // may be zero
 
 	c      chan string
 	noquit bool
@@ -83,6 +90,24 @@ type Browser struct {
 	cursor  int
 	input   string
 	matches []int
+
+	// preview pane focus, for selecting the track to start playback at.
+	// only in Queue, Resumes and Albums modes
+	focus  bool
+	tracks []string // fullpaths; only set when focused
+	track  int      // cursor in tracks
+
+	// discogs url of the selected item is being entered (ctrl+e); all
+	// keys go to editInput until enter or esc
+	editing   bool
+	editInput string
+	editErr   error
+
+	// likewise, a time budget is being entered (ctrl+b, Queue mode only),
+	// separately from the search input
+	budgeting   bool
+	budgetInput string
+	budgetErr   error
 }
 
 // All items must be valid relpaths (relative to root)
@@ -106,6 +131,8 @@ func newBrowser(items []string, mode Mode) *Browser {
 		mode:    mode,
 		items:   items,
 		matches: intRange(len(items)),
+		mapping: readMapping(),
+		mirror:  readMirror(),
 		c:       make(chan string),
 
 		width:  width,
@@ -137,19 +164,21 @@ func queueBrowser() (b *Browser) {
 		}()
 	}
 
-	resumes := getResumes()
+	resumes := player.Resumes()
 	switch {
 	case firstRun:
 		firstRun = false
-		if resumes != nil && len(*resumes) > 0 { // TODO: Once.Do
-			b = newBrowser(*resumes, Queue)
+		if len(resumes) > 0 { // TODO: Once.Do
+			b = newBrowser(resumes, Queue)
 			b.noquit = true
+			b.progress = readProgress()
 			return b
 		}
 		fallthrough
 	default:
 		b = newBrowser(getQueue(config.NQueue), Queue)
 	}
+	b.progress = readProgress()
 
 	// if firstRun is set to false here, albums can never be played on demand
 	// firstRun = false
@@ -213,6 +242,7 @@ func albumsBrowser(artist string) *Browser {
 	b := newBrowser(items, Albums)
 	b.queued = queued
 	b.previews = previews
+	b.progress = readProgress()
 
 	return b
 }
@@ -221,6 +251,9 @@ func (b *Browser) updateSearch() {
 	// https://github.com/antonmedv/walk/blob/ba821ed78f31e0ebd46eeef19cfe642fc1ec4330/main.go#L427
 	// note the pointer; we are mutating Browser
 
+	// selection will (probably) change
+	b.focus = false
+
 	switch {
 
 	case b.input == "":
@@ -249,11 +282,12 @@ func (b *Browser) updateSearch() {
 
 // b.items must already have been initialised.
 func (b *Browser) Init() tea.Cmd {
-	if b.mode == Queue {
+	// previews may already have been supplied (e.g. by budgetItems)
+	if b.mode == Queue && b.previews == nil {
 		go func() {
 			previews := make(map[string][]string)
 			for _, item := range b.items {
-				p, err := descend(item)
+				p, err := descend(filepath.Join(config.Library.Root, item))
 				if err != nil {
 					continue
 				}
@@ -285,6 +319,25 @@ func (b *Browser) Update(msg tea.Msg) (tea.Model, tea.Cmd) { // {{{
 	// notice this (subtle) reassignment
 	switch msg := msg.(type) {
 
+	case playMsg: // before-play hook done
+		return b, playback(msg.relpath, msg.track)
+
+	case resumeMsg: // playback was interrupted
+		if config.Playback.OnResume != "queue" {
+			log.Println("quitting, will resume:", msg.relpath)
+			return b, tea.Quit
+		}
+		nb := queueBrowser()
+		if !slices.Contains(nb.items, msg.relpath) {
+			nb.items = append([]string{msg.relpath}, nb.items...)
+			nb.matches = intRange(len(nb.items))
+		}
+		nb.resumable = make(map[string]bool)
+		for _, item := range nb.items {
+			nb.resumable[item] = player.WillResume(item)
+		}
+		return nb, tea.ClearScreen
+
 	// https://github.com/charmbracelet/bubbletea/discussions/818#discussioncomment-6914769
 	case tea.WindowSizeMsg:
 		if msg.Width != b.width {
@@ -301,6 +354,13 @@ func (b *Browser) Update(msg tea.Msg) (tea.Model, tea.Cmd) { // {{{
 
 	case tea.KeyMsg:
 
+		if b.editing {
+			return b.updateEdit(msg)
+		}
+		if b.budgeting {
+			return b.updateBudget(msg)
+		}
+
 		if len(b.matches) > 0 && // prevent further input when no matches
 			msg.Type == tea.KeyRunes || msg.String() == " " {
 			b.input += string(msg.Runes)
@@ -315,10 +375,62 @@ func (b *Browser) Update(msg tea.Msg) (tea.Model, tea.Cmd) { // {{{
 
 		case "ctrl+t", "tab":
 			// TODO: else -> queue?
-			if !mpvRunning() && b.mode == Queue {
+			if !player.Running() && b.mode == Queue {
 				return artistBrowser(), nil
 			}
 
+		case "right": // focus preview pane
+			if b.mode == Artists || len(b.matches) == 0 {
+				break
+			}
+			sel := b.items[b.matches[b.cursor]]
+			tracks, err := albumTracks(filepath.Join(config.Library.Root, sel))
+			if err != nil || len(tracks) == 0 {
+				break
+			}
+			b.focus = true
+			b.tracks = tracks
+			b.track = 0
+
+		case "left":
+			b.focus = false
+			b.tracks = nil
+
+		case "ctrl+r":
+			if b.mode == Queue {
+				return resumeBrowser(), tea.ClearScreen
+			}
+
+		case "ctrl+d": // discard resume of selected album
+			if b.mode == Resumes && len(b.matches) > 0 {
+				if err := discardResumes(b.items[b.matches[b.cursor]]); err != nil {
+					log.Println(err)
+				}
+				return resumeBrowser(), tea.ClearScreen
+			}
+
+		case "ctrl+x": // discard resumes of albums that no longer exist
+			if b.mode == Resumes {
+				n, err := cleanResumes()
+				log.Println("cleaned", n, "resumes", err)
+				return resumeBrowser(), tea.ClearScreen
+			}
+
+		case "ctrl+b": // enter a time budget, e.g. "45" or "1h30m"
+			if b.mode != Queue {
+				break
+			}
+			b.budgeting = true
+			b.budgetErr = nil
+
+		case "ctrl+e": // edit discogs mapping of selected item
+			if len(b.matches) == 0 {
+				break
+			}
+			b.editing = true
+			b.editErr = nil
+			b.editInput = b.mappingOf(b.items[b.matches[b.cursor]])
+
 		case "ctrl+w": // delete last word
 			i := strings.LastIndex(b.input, " ")
 			if i+1 == len(b.input) { // only one word (with trailing space)
@@ -350,6 +462,10 @@ func (b *Browser) Update(msg tea.Msg) (tea.Model, tea.Cmd) { // {{{
 			}
 
 		case "up", "ctrl+k":
+			if b.focus {
+				b.track = (b.track - 1 + len(b.tracks)) % len(b.tracks)
+				break
+			}
 			b.cursor--
 			if b.cursor < 0 {
 				b.cursor = len(b.matches) - 1
@@ -364,6 +480,10 @@ func (b *Browser) Update(msg tea.Msg) (tea.Model, tea.Cmd) { // {{{
 			b.offset += b.height
 
 		case "down", "ctrl+j":
+			if b.focus {
+				b.track = (b.track + 1) % len(b.tracks)
+				break
+			}
 			b.cursor++
 			if b.cursor > len(b.matches)-1 {
 				b.cursor = 0
@@ -390,18 +510,99 @@ func (b *Browser) Update(msg tea.Msg) (tea.Model, tea.Cmd) { // {{{
 	return b, nil
 } // }}}
 
+// Discogs mapping of an item, as a partial url (e.g. "master/6440"); empty if
+// not mapped
+func (b *Browser) mappingOf(item string) string {
+	if b.mode == Artists {
+		if id, ok := b.mapping.Artists[item]; ok {
+			return fmt.Sprintf("artist/%d", id)
+		}
+		return ""
+	}
+	if m, ok := b.mapping.Albums[item]; ok {
+		return m.String()
+	}
+	return ""
+}
+
+func (b *Browser) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter": // empty input clears the mapping
+		sel := b.items[b.matches[b.cursor]]
+		if err := editMapping(sel, b.mode, strings.TrimSpace(b.editInput)); err != nil {
+			b.editErr = err
+			break
+		}
+		b.mapping = readMapping()
+		b.editing = false
+	case "ctrl+c", "esc":
+		b.editing = false
+	case "ctrl+u":
+		b.editInput = ""
+	case "backspace":
+		if len(b.editInput) > 0 {
+			b.editInput = b.editInput[:len(b.editInput)-1]
+		}
+	default:
+		b.editInput += string(msg.Runes)
+	}
+	return b, nil
+}
+
+func (b *Browser) updateBudget(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		budget, ok := parseBudget(b.budgetInput)
+		if !ok {
+			b.budgetErr = fmt.Errorf("invalid budget: %q", b.budgetInput)
+			break
+		}
+		items, previews := budgetItems(budget)
+		log.Println("fits", budget, len(items))
+		nb := newBrowser(items, Queue)
+		nb.previews = previews
+		nb.noquit = true
+		return nb, tea.ClearScreen
+	case "ctrl+c", "esc":
+		b.budgeting = false
+	case "ctrl+u":
+		b.budgetInput = ""
+	case "backspace":
+		if len(b.budgetInput) > 0 {
+			b.budgetInput = b.budgetInput[:len(b.budgetInput)-1]
+		}
+	default:
+		b.budgetInput += string(msg.Runes)
+	}
+	return b, nil
+}
+
+func (b *Browser) budgetPrompt() string {
+	s := "time budget (e.g. 45 or 1h30m): " + b.budgetInput
+	if b.budgetErr != nil {
+		s += " (" + b.budgetErr.Error() + ")"
+	}
+	return s
+}
+
 // Artists -> Albums
-// Queue -> Albums
+// Queue/Resumes -> Albums
 // Albums -> play -> Queue
 func (b *Browser) getNewState() (*Browser, tea.Cmd) {
 	pos := b.matches[b.cursor]
 	sel := b.items[pos] // relpath
+
+	var track int // only non-zero if preview is focused
+	if b.focus {
+		track = b.track
+	}
+
 	switch b.mode {
 	case Artists:
 		// return albumsBrowser(sel), nil
 		return albumsBrowser(sel), tea.ClearScreen
 
-	case Queue:
+	case Queue, Resumes:
 
 		// note: we need to split artist here (even though we do it
 		// again in `play`)
@@ -424,23 +625,25 @@ func (b *Browser) getNewState() (*Browser, tea.Cmd) {
 			q := getQueue(0)
 			nq := remove(&q, sel)
 			writeQueue(*nq)
+			emit(Dequeued, newHookVars(sel), "")
 			return queueBrowser(), tea.ClearScreen
 		}
 
-		return nb, play(sel)
+		return nb, play(sel, track)
 
 	case Albums:
-		if mpvRunning() {
+		if player.Running() {
 			if _, err := os.Stat(filepath.Join(config.Library.Root, sel)); err == nil {
 				q := getQueue(0)
 				nq := append(q, sel)
 				ensure(len(nq)-len(q) == 1)
 				writeQueue(nq)
 				log.Println("queued:", sel)
+				emit(Enqueued, newHookVars(sel), "")
 			}
 			return b, tea.Quit
-		} else if firstRun { // only reachable via <tab> in queue mode
-			return queueBrowser(), play(sel)
+		} else if firstRun || b.focus { // focus (<tab>); the album may not be queued
+			return queueBrowser(), play(sel, track)
 		} else {
 			return queueBrowser(), tea.ClearScreen
 		}
@@ -468,6 +671,9 @@ func (b *Browser) View() string {
 	// https://github.com/charmbracelet/bubbletea/blob/master/examples/split-editors/main.go
 
 	if len(b.matches) == 0 {
+		if b.budgeting { // the budget does not depend on the search
+			return b.budgetPrompt()
+		}
 		return "no matches; please clear input"
 	}
 
@@ -491,18 +697,34 @@ func (b *Browser) View() string {
 		}
 		item := b.items[idx] // idx is the actual index that points to the item
 
+		var suffix string
+		if p, ok := b.progress[item]; ok {
+			suffix = " (" + p.String() + ")"
+		}
+		if b.resumable[item] {
+			suffix += " (resumable)"
+		}
+		if m := b.mappingOf(item); m != "" {
+			suffix += " (" + m + ")"
+		}
+		if b.mode != Artists {
+			if s := b.mirror.badge(b.mapping.Albums[item]); s != "" {
+				suffix += " " + s
+			}
+		}
+
 		switch {
 		case anyQueued:
 			base := path.Base(item)
 			item = IsQueued[b.queued[item]] + " " + base
-			leftItems.Item(item) // inplace
+			leftItems.Item(item + suffix) // inplace
 
 		case b.mode == Albums:
 			base := path.Base(item)
-			leftItems.Item(base)
+			leftItems.Item(base + suffix)
 
 		default:
-			leftItems.Item(item)
+			leftItems.Item(item + suffix)
 		}
 	}
 
@@ -513,6 +735,15 @@ func (b *Browser) View() string {
 	previews, err := descend(p)
 
 	switch {
+	case b.focus:
+		// tracks (including those in subdirs) relative to album
+		rightItems.Enumerator(func(_ list.Items, index int) string {
+			return IsSelected[index == b.track]
+		})
+		for _, t := range b.tracks {
+			rel, _ := filepath.Rel(p, t)
+			rightItems.Item(rel)
+		}
 	case ok: // usually only in Albums mode
 		rightItems.Items(preview)
 	case err != nil:
@@ -537,5 +768,16 @@ func (b *Browser) View() string {
 			Render(rightItems.String()),
 	)
 
-	return lipgloss.JoinVertical(lipgloss.Left, b.input, panes)
+	top := b.input
+	if b.editing {
+		top = fmt.Sprintf("discogs url for %s (empty to clear): %s", sel, b.editInput)
+		if b.editErr != nil {
+			top += " (" + b.editErr.Error() + ")"
+		}
+	}
+	if b.budgeting {
+		top = b.budgetPrompt()
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left, top, panes)
 }
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"path/filepath"
 	"strings"
 	"testing"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/x/exp/teatest"
+	"github.com/stretchr/testify/assert"
 )
 
 // t.Run("mock", func(t *testing.T) {
@@ -109,3 +111,80 @@ func TestUIBasic(t *testing.T) {
 	// tm.Send(tea.KeyMsg{Type: tea.KeyCtrlK})
 	// checkModelOutput(t, tm, "→ C")
 }
+
+func TestUIFocus(t *testing.T) {
+	b := Browser{
+		items:    []string{"A/x", "B/y"},
+		matches:  []int{0, 1},
+		previews: map[string][]string{"A/x": {"CD1"}},
+		focus:    true,
+		tracks: []string{
+			filepath.Join(config.Library.Root, "A/x/CD1/01.flac"),
+			filepath.Join(config.Library.Root, "A/x/CD2/01.flac"),
+		},
+	}
+
+	tm := teatest.NewTestModel(t, &b, teatest.WithInitialTermSize(80, 10))
+	checkModelOutput(t, tm, "→ CD1/01.flac")
+	tm.Send(tea.KeyMsg{Type: tea.KeyDown})
+	checkModelOutput(t, tm, "→ CD2/01.flac")
+
+	// left pane cursor is unaffected
+	tm.Send(tea.KeyMsg{Type: tea.KeyLeft})
+	tm.Send(tea.KeyMsg{Type: tea.KeyDown})
+	checkModelOutput(t, tm, "→ B/y")
+}
+
+func TestUIMapping(t *testing.T) {
+	state := config.StateDir
+	defer func() { config.StateDir = state }()
+	config.StateDir = t.TempDir()
+
+	b := Browser{
+		mode:     Queue,
+		items:    []string{"A/x", "B/y"},
+		matches:  []int{0, 1},
+		previews: map[string][]string{"A/x": {"1"}, "B/y": {"2"}},
+	}
+
+	tm := teatest.NewTestModel(t, &b, teatest.WithInitialTermSize(80, 10))
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlE})
+	tm.Send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("artist/1")})
+	tm.Send(tea.KeyMsg{Type: tea.KeyEnter})
+	checkModelOutput(t, tm, "cannot map A/x to artist")
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlU})
+	tm.Send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("https://www.discogs.com/master/6440-x")})
+	tm.Send(tea.KeyMsg{Type: tea.KeyEnter})
+	checkModelOutput(t, tm, "A/x (master/6440)")
+	assert.Equal(t, readMapping().Albums["A/x"], mappedRelease{Id: 6440, Master: true})
+
+	// cleared with empty input
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlE})
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlU})
+	tm.Send(tea.KeyMsg{Type: tea.KeyEnter})
+	tm.Send(tea.QuitMsg{})
+	tm.WaitFinished(t)
+	assert.Empty(t, readMapping().Albums)
+}
+
+func TestUIBudget(t *testing.T) {
+	// no matches, so the search input would not take further runes
+	b := Browser{mode: Queue, items: []string{"A/x"}, input: "zzz"}
+
+	tm := teatest.NewTestModel(t, &b, teatest.WithInitialTermSize(80, 10))
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlB})
+	for _, r := range "45x" {
+		tm.Send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	tm.Send(tea.KeyMsg{Type: tea.KeyEnter})
+	checkModelOutput(t, tm, `invalid budget: "45x"`)
+
+	tm.Send(tea.KeyMsg{Type: tea.KeyBackspace})
+	tm.Send(tea.KeyMsg{Type: tea.KeyEsc})
+	tm.Send(tea.QuitMsg{})
+	tm.WaitFinished(t)
+	assert.False(t, b.budgeting)
+	assert.Equal(t, b.budgetInput, "45")
+	assert.Equal(t, b.input, "zzz")
+}
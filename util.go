@@ -47,6 +47,20 @@ func checkRelPaths(items []string) {
 	}
 }
 
+// https://specifications.freedesktop.org/basedir-spec/latest/
+func xdgStateHome() string {
+	if d := os.Getenv("XDG_STATE_HOME"); d != "" {
+		return d
+	}
+	return os.ExpandEnv("$HOME/.local/state")
+}
+
+// Path of a file in the state dir, which is created if necessary
+func statePath(name string) string {
+	_ = os.MkdirAll(config.StateDir, 0755)
+	return filepath.Join(config.StateDir, name)
+}
+
 func timer(name string) func() {
 	// https://stackoverflow.com/a/45766707
 	start := time.Now() // at time of defer
@@ -108,12 +122,14 @@ func descend(base string) ([]string, error) {
 
 // "a", "b [c]"
 // "a c", "b"
+//
+// Albums without " [" (e.g. "[Untitled]") are returned unchanged.
 func movePerfsToArtist(artist string, album string) (string, string) {
-	// TODO:
-	// strings.LastIndex(album, " [")
-	x := strings.SplitN(album, " [", 2) // "b", "c]"
-	perfs := strings.TrimSuffix(x[1], "]")
-	return artist + " " + perfs, x[0]
+	title, perfs, ok := strings.Cut(album, " [") // "b", "c]"
+	if !ok {
+		return artist, album
+	}
+	return artist + " " + strings.TrimSuffix(perfs, "]"), title
 }
 
 // Sort a slice of albums by year suffix (" (YYYY)"). Sorting is performed